@@ -28,14 +28,37 @@ func NewCheckoutCommand() *cobra.Command {
 		},
 	}
 
+	BindFlags(command, app)
+	app.IsBare = false
+
+	return command
+}
+
+// BindFlags binds options of checkout to the command, so those can be reused by other commands like `sync`
+func BindFlags(command *cobra.Command, app *Command) {
 	command.Flags().StringVarP(&app.LogLevel, "log-level", "l", "info", "Logging level: error, warn, info, debug")
 	command.Flags().StringVarP(&app.Path, "path", "p", "./", "GIT repository target path")
-	command.Flags().StringVarP(&app.Username, "username", "U", "__token__", "GIT basic auth username")
-	command.Flags().StringVarP(&app.Token, "token", "t", "", "GIT basic auth token/password")
+	command.Flags().StringVarP(&app.Username, "username", "U", "", "GIT basic auth username (defaults to: GIT_USER environment variable, then to: __token__)")
+	command.Flags().StringVarP(&app.Token, "token", "t", "", "GIT basic auth token/password (defaults to: GIT_TOKEN environment variable, which is preferred as it is not visible in process list)")
+	command.Flags().StringVarP(&app.SSHKeyPath, "ssh-key-path", "", "", "Path to SSH private key used for GIT-SSH urls (defaults to: GIT_SSH_KEY environment variable containing the key itself)")
+	command.Flags().StringVarP(&app.SSHKeyPassphrase, "ssh-key-passphrase", "", "", "SSH private key passphrase (defaults to: GIT_SSH_KEY_PASSPHRASE environment variable)")
+	command.Flags().StringVarP(&app.KnownHostsPath, "known-hosts-path", "", "", "Path to known_hosts file used to verify SSH host key (defaults to: SSH_KNOWN_HOSTS environment variable, then to: ~/.ssh/known_hosts)")
 	command.Flags().StringVarP(&app.Revision, "rev", "r", "", "GIT revision - commit/branch/tag (defaults to: main)")
+	command.Flags().StringVarP(&app.Commit, "commit", "", "", "Check out exactly this commit hash, after fetching --rev (e.g. a commit the branch pointed to at admission time)")
 	command.Flags().BoolVarP(&app.CleanUpRemotes, "clean-remotes", "", true, "Delete `git remote` from local repository to prevent token leak")
 	command.Flags().BoolVarP(&app.CleanUpWorkspace, "clean-workspace", "c", true, "Cleans up workspace (deletes all unstaged and external changes)")
-	app.IsBare = false
-
-	return command
+	command.Flags().IntVarP(&app.Depth, "depth", "", 0, "Limit fetched history to given number of commits (0 = full history)")
+	command.Flags().BoolVarP(&app.SingleBranch, "single-branch", "", false, "Fetch only the branch/tag specified with --rev")
+	command.Flags().BoolVarP(&app.NoTags, "no-tags", "", false, "Do not fetch tags")
+	command.Flags().BoolVarP(&app.RecurseSubmodules, "recurse-submodules", "", false, "Clone and update submodules, credentials are used only for submodules on the same host as the repository")
+	command.Flags().IntVarP(&app.SubmodulesDepth, "submodules-depth", "", 10, "Maximum depth of nested submodules (used with --recurse-submodules)")
+	command.Flags().BoolVarP(&app.LFS, "lfs", "", false, "Download Git LFS objects over the LFS batch API (HTTP/HTTPS urls only), replacing pointer files")
+	command.Flags().StringSliceVarP(&app.LFSInclude, "lfs-include", "", []string{}, "Download only LFS objects matching given glob patterns e.g. --lfs-include '*.png,assets/fonts'")
+	command.Flags().StringSliceVarP(&app.LFSExclude, "lfs-exclude", "", []string{}, "Do not download LFS objects matching given glob patterns")
+	command.Flags().StringVarP(&app.VerifyKeysPath, "verify-keys-path", "", "", "Verify signature of checked out commit/tag using armored public keys from given file or directory (e.g. mounted ConfigMap)")
+	command.Flags().StringVarP(&app.TerminationMessagePath, "termination-message-path", "", "", "Write a JSON summary of the checkout (url, ref, commit, commitTime, duration) to given file e.g. /dev/termination-log")
+	command.Flags().StringVarP(&app.Chown, "chown", "", "", "After a successful clone/update change owner of the worktree to numeric 'uid:gid' (requires CAP_CHOWN, e.g. running as root)")
+	command.Flags().BoolVarP(&app.ChownGitDir, "chown-git-dir", "", false, "Change owner of `.git` as well (used with --chown)")
+	command.Flags().StringVarP(&app.Chmod, "chmod", "", "keep", "Permissions applied together with --chown: keep, private, group-readable, group-writable, world-readable")
+	command.Flags().StringSliceVarP(&app.Sparse, "sparse", "", []string{}, "Check out only selected directories e.g. --sparse wp-content/themes/foo,wp-content/plugins/bar")
 }
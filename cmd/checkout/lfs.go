@@ -0,0 +1,372 @@
+package checkout
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	lfsPointerVersion  = "version https://git-lfs.github.com/spec/v1"
+	lfsMediaType       = "application/vnd.git-lfs+json"
+	lfsMaxPointerSize  = 1024
+	lfsObjectsPerBatch = 100
+)
+
+// lfsOidRegexp matches a sha256 oid, the oid is a part of a path in the LFS cache so nothing else can be accepted
+var lfsOidRegexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// lfsPointer is a small text file committed into the repository instead of the real file
+type lfsPointer struct {
+	Path string
+	Oid  string
+	Size int64
+}
+
+type lfsBatchRequest struct {
+	Operation string           `json:"operation"`
+	Transfers []string         `json:"transfers"`
+	Objects   []lfsBatchObject `json:"objects"`
+}
+
+type lfsBatchObject struct {
+	Oid     string               `json:"oid"`
+	Size    int64                `json:"size"`
+	Actions map[string]lfsAction `json:"actions,omitempty"`
+	Error   *lfsError            `json:"error,omitempty"`
+}
+
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header,omitempty"`
+}
+
+type lfsError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lfsBatchResponse struct {
+	Objects []lfsBatchObject `json:"objects"`
+	Message string           `json:"message,omitempty"`
+}
+
+// fetchLFSObjects replaces Git LFS pointer files in the worktree with real files downloaded over the LFS batch API.
+// Downloaded objects are kept in `.git/lfs/objects`, so the next update does not download unchanged files again
+func (c *Command) fetchLFSObjects() error {
+	if c.isSSHUrl() {
+		return errors.New("Git LFS is supported only for HTTP(S) urls")
+	}
+
+	pointers, err := c.findLFSPointers()
+	if err != nil {
+		return errors.Wrap(err, "Cannot look up Git LFS pointer files in the worktree")
+	}
+	if len(pointers) == 0 {
+		logrus.Info("No Git LFS pointer files found")
+		return nil
+	}
+	logrus.Infof("Found %v Git LFS pointer files", len(pointers))
+
+	var missing []lfsPointer
+	for _, pointer := range pointers {
+		if restored, restoreErr := c.restoreLFSObjectFromCache(pointer); restoreErr != nil {
+			return restoreErr
+		} else if !restored {
+			missing = append(missing, pointer)
+		}
+	}
+
+	client := &http.Client{Timeout: 10 * time.Minute}
+	for start := 0; start < len(missing); start += lfsObjectsPerBatch {
+		end := start + lfsObjectsPerBatch
+		if end > len(missing) {
+			end = len(missing)
+		}
+		if err := c.downloadLFSBatch(client, missing[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findLFSPointers walks the worktree looking for LFS pointer files matching --lfs-include and --lfs-exclude. Submodules are skipped
+func (c *Command) findLFSPointers() ([]lfsPointer, error) {
+	var pointers []lfsPointer
+
+	err := filepath.WalkDir(c.Path, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, _ := filepath.Rel(c.Path, filePath)
+		relative = filepath.ToSlash(relative)
+
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			// nested repository (submodule) has its own LFS storage
+			if _, statErr := os.Lstat(filepath.Join(filePath, ".git")); relative != "." && statErr == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || !c.isLFSPathIncluded(relative) {
+			return nil
+		}
+
+		pointer, isPointer, readErr := readLFSPointer(filePath)
+		if readErr != nil {
+			return readErr
+		}
+		if isPointer {
+			pointer.Path = relative
+			pointers = append(pointers, pointer)
+		}
+		return nil
+	})
+	return pointers, err
+}
+
+// isLFSPathIncluded matches the path against --lfs-include and --lfs-exclude. Patterns without a "/" are matched against file name
+func (c *Command) isLFSPathIncluded(relative string) bool {
+	matches := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			subject := relative
+			if !strings.Contains(pattern, "/") {
+				subject = path.Base(relative)
+			}
+			if matched, _ := path.Match(pattern, subject); matched {
+				return true
+			}
+			// directory prefix e.g. "assets/fonts" or "assets/fonts/"
+			if strings.HasPrefix(relative, strings.TrimSuffix(pattern, "/")+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(c.LFSInclude) > 0 && !matches(c.LFSInclude) {
+		return false
+	}
+	return !matches(c.LFSExclude)
+}
+
+// readLFSPointer parses a LFS pointer file, second returned value tells if the file is a pointer at all
+func readLFSPointer(filePath string) (lfsPointer, bool, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return lfsPointer{}, false, err
+	}
+	if info.Size() > lfsMaxPointerSize {
+		return lfsPointer{}, false, nil
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return lfsPointer{}, false, err
+	}
+	if !bytes.HasPrefix(content, []byte(lfsPointerVersion)) {
+		return lfsPointer{}, false, nil
+	}
+
+	pointer := lfsPointer{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), " ")
+		switch key {
+		case "oid":
+			pointer.Oid = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			pointer.Size, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	if !lfsOidRegexp.MatchString(pointer.Oid) {
+		return lfsPointer{}, false, errors.Errorf("Invalid Git LFS pointer file '%s', missing sha256 oid", filePath)
+	}
+	return pointer, true, nil
+}
+
+// getLFSEndpoint returns LFS server url as described in Git LFS specification e.g. https://git.example.org/org/repo.git/info/lfs
+func (c *Command) getLFSEndpoint() string {
+	endpoint := strings.TrimSuffix(c.Url, "/")
+	if !strings.HasSuffix(endpoint, ".git") {
+		endpoint += ".git"
+	}
+	return endpoint + "/info/lfs"
+}
+
+// downloadLFSBatch asks the LFS server for download links, then downloads objects one-by-one
+func (c *Command) downloadLFSBatch(client *http.Client, pointers []lfsPointer) error {
+	request := lfsBatchRequest{Operation: "download", Transfers: []string{"basic"}}
+	for _, pointer := range pointers {
+		request.Objects = append(request.Objects, lfsBatchObject{Oid: pointer.Oid, Size: pointer.Size})
+	}
+	body, _ := json.Marshal(request)
+
+	req, err := http.NewRequest(http.MethodPost, c.getLFSEndpoint()+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "Cannot prepare Git LFS batch request")
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	c.setLFSCredentials(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Cannot send Git LFS batch request")
+	}
+	defer resp.Body.Close()
+
+	var batch lfsBatchResponse
+	if decodeErr := json.NewDecoder(resp.Body).Decode(&batch); decodeErr != nil && resp.StatusCode == http.StatusOK {
+		return errors.Wrap(decodeErr, "Cannot decode Git LFS batch response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Git LFS batch request failed with HTTP %v: %s", resp.StatusCode, batch.Message)
+	}
+
+	byOid := map[string]lfsBatchObject{}
+	for _, object := range batch.Objects {
+		byOid[object.Oid] = object
+	}
+	for _, pointer := range pointers {
+		object, found := byOid[pointer.Oid]
+		if !found {
+			return errors.Errorf("Git LFS server did not return object '%s' (%s)", pointer.Oid, pointer.Path)
+		}
+		if object.Error != nil {
+			return errors.Errorf("Git LFS server cannot provide object '%s' (%s): %v %s", pointer.Oid, pointer.Path, object.Error.Code, object.Error.Message)
+		}
+		action, hasDownload := object.Actions["download"]
+		if !hasDownload {
+			return errors.Errorf("Git LFS server did not return a download link for '%s' (%s)", pointer.Oid, pointer.Path)
+		}
+		if err := c.downloadLFSObject(client, pointer, action); err != nil {
+			return errors.Wrapf(err, "Cannot download Git LFS object for '%s'", pointer.Path)
+		}
+	}
+	return nil
+}
+
+// setLFSCredentials reuses the basic auth credentials of the repository
+func (c *Command) setLFSCredentials(req *http.Request) {
+	if c.Username != "" && c.Token != "" {
+		req.SetBasicAuth(c.Username, c.Token)
+	}
+}
+
+// downloadLFSObject downloads a single object into the LFS cache, verifies the checksum, then replaces the pointer file
+func (c *Command) downloadLFSObject(client *http.Client, pointer lfsPointer, action lfsAction) error {
+	logrus.Infof("Downloading Git LFS object for '%s' (%v bytes)", pointer.Path, pointer.Size)
+
+	req, err := http.NewRequest(http.MethodGet, action.Href, nil)
+	if err != nil {
+		return err
+	}
+	for name, value := range action.Header {
+		req.Header.Set(name, value)
+	}
+	// download links pointing to the same server usually require the same credentials
+	if len(action.Header) == 0 && strings.HasPrefix(action.Href, c.getLFSEndpoint()) {
+		c.setLFSCredentials(req)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("HTTP %v", resp.StatusCode)
+	}
+
+	cachePath := c.getLFSCachePath(pointer.Oid)
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
+	temporary := cachePath + ".tmp"
+	file, err := os.Create(temporary)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	written, copyErr := io.Copy(io.MultiWriter(file, hash), resp.Body)
+	closeErr := file.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != pointer.Oid || written != pointer.Size {
+		_ = os.Remove(temporary)
+		return errors.Errorf("checksum mismatch, expected sha256 %s (%v bytes), got %s (%v bytes)", pointer.Oid, pointer.Size, sum, written)
+	}
+	if err := os.Rename(temporary, cachePath); err != nil {
+		return err
+	}
+
+	if _, err := c.restoreLFSObjectFromCache(pointer); err != nil {
+		return err
+	}
+	return nil
+}
+
+// restoreLFSObjectFromCache replaces the pointer file with an already downloaded object, returns false if the object was not downloaded yet
+func (c *Command) restoreLFSObjectFromCache(pointer lfsPointer) (bool, error) {
+	cachePath := c.getLFSCachePath(pointer.Oid)
+	info, err := os.Stat(cachePath)
+	if err != nil || info.Size() != pointer.Size {
+		return false, nil
+	}
+
+	target := filepath.Join(c.Path, filepath.FromSlash(pointer.Path))
+	targetInfo, err := os.Stat(target)
+	if err != nil {
+		return false, err
+	}
+	source, err := os.Open(cachePath)
+	if err != nil {
+		return false, err
+	}
+	defer source.Close()
+
+	// replaced atomically, so the application never reads a partially written file
+	temporary := target + ".lfs-tmp"
+	destination, err := os.OpenFile(temporary, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, targetInfo.Mode().Perm())
+	if err != nil {
+		return false, err
+	}
+	_, copyErr := io.Copy(destination, source)
+	closeErr := destination.Close()
+	if copyErr != nil {
+		return false, copyErr
+	}
+	if closeErr != nil {
+		return false, closeErr
+	}
+	if err := os.Rename(temporary, target); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// getLFSCachePath returns a path in the same layout as the `git-lfs` uses e.g. .git/lfs/objects/4d/7a/4d7a...
+func (c *Command) getLFSCachePath(oid string) string {
+	return filepath.Join(c.Path, ".git", "lfs", "objects", oid[0:2], oid[2:4], oid)
+}
@@ -0,0 +1,136 @@
+package checkout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// lfsStubServer serves Git LFS batch API for given objects, requires basic auth credentials
+func lfsStubServer(t *testing.T, objects map[string][]byte) (*httptest.Server, *int) {
+	downloads := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		if user != "riotkit" || password != "psst" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message": "Credentials needed"}`))
+			return
+		}
+
+		if r.URL.Path == "/themes/iwa.git/info/lfs/objects/batch" {
+			var request lfsBatchRequest
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+			assert.Equal(t, "download", request.Operation)
+
+			response := lfsBatchResponse{}
+			for _, object := range request.Objects {
+				object.Actions = map[string]lfsAction{"download": {Href: server.URL + "/themes/iwa.git/info/lfs/objects/" + object.Oid}}
+				response.Objects = append(response.Objects, object)
+			}
+			w.Header().Set("Content-Type", lfsMediaType)
+			_ = json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		oid := filepath.Base(r.URL.Path)
+		if content, found := objects[oid]; found {
+			downloads++
+			_, _ = w.Write(content)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	return server, &downloads
+}
+
+// writeLFSPointer places a pointer file in the worktree, returns the oid
+func writeLFSPointer(t *testing.T, dir string, name string, content []byte) string {
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+	pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content))
+	assert.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(pointer), 0644))
+	return oid
+}
+
+func TestFetchLFSObjects(t *testing.T) {
+	dir := t.TempDir()
+	logo := []byte("PNG image")
+	font := []byte("TTF font")
+	objects := map[string][]byte{
+		writeLFSPointer(t, dir, "images/logo.png", logo):   logo,
+		writeLFSPointer(t, dir, "fonts/anarchy.ttf", font): font,
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# Theme"), 0644))
+
+	server, downloads := lfsStubServer(t, objects)
+	defer server.Close()
+
+	c := Command{
+		Path:       dir,
+		Url:        server.URL + "/themes/iwa.git",
+		Username:   "riotkit",
+		Token:      "psst",
+		LFSExclude: []string{"*.ttf"},
+	}
+	assert.Nil(t, c.fetchLFSObjects())
+
+	content, _ := os.ReadFile(filepath.Join(dir, "images/logo.png"))
+	assert.Equal(t, logo, content)
+	fontContent, _ := os.ReadFile(filepath.Join(dir, "fonts/anarchy.ttf"))
+	assert.Contains(t, string(fontContent), "version https://git-lfs.github.com/spec/v1", "Excluded files should stay as pointers")
+	assert.Equal(t, 1, *downloads)
+
+	// objects are cached in `.git/lfs/objects` - restored pointer is not downloaded again
+	writeLFSPointer(t, dir, "images/logo.png", logo)
+	assert.Nil(t, c.fetchLFSObjects())
+	content, _ = os.ReadFile(filepath.Join(dir, "images/logo.png"))
+	assert.Equal(t, logo, content)
+	assert.Equal(t, 1, *downloads)
+}
+
+func TestFetchLFSObjects_InvalidCredentials(t *testing.T) {
+	dir := t.TempDir()
+	writeLFSPointer(t, dir, "logo.png", []byte("PNG image"))
+
+	server, _ := lfsStubServer(t, map[string][]byte{})
+	defer server.Close()
+
+	c := Command{Path: dir, Url: server.URL + "/themes/iwa", Username: "riotkit", Token: "invalid"}
+	err := c.fetchLFSObjects()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "HTTP 401: Credentials needed")
+}
+
+func TestIsLFSPathIncluded(t *testing.T) {
+	c := Command{LFSInclude: []string{"*.png", "assets/fonts"}, LFSExclude: []string{"assets/fonts/*.woff"}}
+
+	assert.True(t, c.isLFSPathIncluded("images/logo.png"))
+	assert.True(t, c.isLFSPathIncluded("assets/fonts/anarchy.ttf"))
+	assert.False(t, c.isLFSPathIncluded("assets/fonts/anarchy.woff"))
+	assert.False(t, c.isLFSPathIncluded("video.mp4"))
+}
+
+func TestReadLFSPointer_RejectsInvalidOid(t *testing.T) {
+	dir := t.TempDir()
+	for _, oid := range []string{
+		"../../../../../../../../etc/cron.d/anarchy/../../../../../../abc",
+		"ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789",
+		"abcdef0123456789",
+	} {
+		pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize 10\n", oid)
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "logo.png"), []byte(pointer), 0644))
+
+		_, isPointer, err := readLFSPointer(filepath.Join(dir, "logo.png"))
+		assert.False(t, isPointer)
+		assert.NotNil(t, err, "Expected that oid '%s' is rejected", oid)
+	}
+}
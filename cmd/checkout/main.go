@@ -5,26 +5,51 @@ import (
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/moby/sys/mountinfo"
 	"github.com/pkg/errors"
 	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/riotkit-org/git-clone-controller/pkg/report"
 	"github.com/sirupsen/logrus"
 	"net/url"
 	"os"
 	"strings"
 	"syscall"
+	"time"
 )
 
 type Command struct {
-	LogLevel         string
-	Path             string
-	Url              string
-	Username         string
-	Token            string
-	Revision         string
-	IsBare           bool
-	CleanUpRemotes   bool
-	CleanUpWorkspace bool
+	LogLevel          string
+	Path              string
+	Url               string
+	Username          string
+	Token             string
+	SSHKey            string
+	SSHKeyPath        string
+	SSHKeyPassphrase  string
+	KnownHostsPath    string
+	Revision          string
+	IsBare            bool
+	CleanUpRemotes    bool
+	CleanUpWorkspace  bool
+	Depth             int
+	SingleBranch      bool
+	NoTags            bool
+	Sparse            []string
+	RecurseSubmodules bool
+	SubmodulesDepth   int
+	LFS               bool
+	LFSInclude        []string
+	LFSExclude        []string
+	VerifyKeysPath    string
+	Commit            string
+	Chown             string
+	ChownGitDir       bool
+	Chmod             string
+
+	TerminationMessagePath string
 }
 
 func (c *Command) Run() error {
@@ -34,25 +59,101 @@ func (c *Command) Run() error {
 
 	c.inspectEnvironment()
 
+	started := time.Now()
+	if c.Chown != "" {
+		if err := c.reclaimOwnership(); err != nil {
+			return errors.Wrap(err, "Cannot take over files of a previous checkout")
+		}
+	}
+	head, err := c.update()
+	if err != nil {
+		return err
+	}
+	logrus.Infof("The local repository is now on '%s', at commit '%s'", head.Name().String(), head.Hash().String())
+
+	if c.Chown != "" {
+		if err := c.applyOwnership(); err != nil {
+			return errors.Wrap(err, "Cannot hand over checked out files")
+		}
+	}
+
+	// the checkout succeeded, a missing report is not a reason to fail the Pod
+	if c.TerminationMessagePath != "" {
+		if err := c.writeSummary(head, time.Since(started)); err != nil {
+			logrus.Warnf("Cannot write checkout summary to '%s': %v", c.TerminationMessagePath, err)
+		}
+	}
+	return nil
+}
+
+// writeSummary writes what was checked out into the termination message file, the controller copies it into Pod annotations
+func (c *Command) writeSummary(head *plumbing.Reference, duration time.Duration) error {
+	repository, err := git.PlainOpen(c.Path)
+	if err != nil {
+		return err
+	}
+	commit, err := repository.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	ref := head.Name().String()
+	if head.Name() == plumbing.HEAD {
+		ref = c.Revision
+	}
+	return report.WriteSummary(c.TerminationMessagePath, report.Summary{
+		Url:        report.StripCredentials(c.Url),
+		Ref:        ref,
+		Commit:     head.Hash().String(),
+		CommitTime: commit.Committer.When,
+		Duration:   duration.Round(time.Millisecond).String(),
+	})
+}
+
+// Checkout clones or updates the repository without inspecting the environment, returns the reference HEAD points to
+func (c *Command) Checkout() (*plumbing.Reference, error) {
+	if err := c.checkAndPrepareInputs(); err != nil {
+		return nil, errors.Wrap(err, "Validation failed")
+	}
+	return c.update()
+}
+
+// update does a clone or checkout, then cleans up the repository
+func (c *Command) update() (*plumbing.Reference, error) {
 	urlWithCredentials, parseUrlErr := c.getUrlWithCredentials()
 	if parseUrlErr != nil {
-		return errors.Wrap(parseUrlErr, "Cannot parse GIT url")
+		return nil, errors.Wrap(parseUrlErr, "Cannot parse GIT url")
+	}
+
+	auth, authErr := c.getAuthMethod()
+	if authErr != nil {
+		return nil, errors.Wrap(authErr, "Cannot prepare SSH authorization")
 	}
 
-	repository, checkoutErr := c.checkout(urlWithCredentials)
+	repository, checkoutErr := c.checkout(urlWithCredentials, auth)
 	if checkoutErr != nil {
-		return errors.Wrap(checkoutErr, "Cannot clone/checkout repository")
+		return nil, errors.Wrap(checkoutErr, "Cannot clone/checkout repository")
+	}
+	if c.VerifyKeysPath != "" {
+		if err := c.verifySignature(repository); err != nil {
+			return nil, errors.Wrap(err, "Signature verification failed")
+		}
+	}
+	if c.LFS && !c.IsBare {
+		if err := c.fetchLFSObjects(); err != nil {
+			return nil, errors.Wrap(err, "Cannot download Git LFS objects")
+		}
 	}
 	if c.CleanUpRemotes {
 		if err := c.cleanUpRemotes(repository); err != nil {
-			return errors.Wrap(err, "Clean up error - cannot remove remotes from local repository")
+			return nil, errors.Wrap(err, "Clean up error - cannot remove remotes from local repository")
 		}
 	}
 
-	head, _ := repository.Head()
-	logrus.Infof("The local repository is now on '%s', at commit '%s'", head.Name().String(), head.Hash().String())
-
-	return nil
+	head, headErr := repository.Head()
+	if headErr != nil {
+		return nil, errors.Wrap(headErr, "Cannot read HEAD of local repository")
+	}
+	return head, nil
 }
 
 // inspectEnvironment is displaying helpful information about the execution environment to help adjust the parameters in case, when the initContainer would fail
@@ -90,7 +191,7 @@ func (c *Command) listDirectory(dirPath string) {
 }
 
 // checkout is performing actually a fresh clone of repository, or update of existing repository
-func (c *Command) checkout(url string) (*git.Repository, error) {
+func (c *Command) checkout(url string, auth transport.AuthMethod) (*git.Repository, error) {
 	if c.isExistingRepository() {
 		logrus.Info("Opening existing repository")
 		repository, err := git.PlainOpen(c.Path)
@@ -98,7 +199,19 @@ func (c *Command) checkout(url string) (*git.Repository, error) {
 			return repository, errors.Wrap(err, "Cannot open git repository")
 		}
 
-		if err := c.fetch(repository, "origin", url); err != nil {
+		// with --single-branch only the requested branch/tag is fetched, same as it was cloned
+		var refSpecs []config.RefSpec
+		if c.SingleBranch {
+			reference, isReference, refErr := c.findRemoteReference(url, auth)
+			if refErr != nil {
+				return repository, refErr
+			}
+			if isReference {
+				refSpecs = append(refSpecs, createRefSpec("origin", reference))
+			}
+		}
+
+		if err := c.fetch(repository, "origin", url, auth, refSpecs); err != nil {
 			return repository, errors.Wrap(err, "Cannot fetch repository (`git fetch`)")
 		}
 
@@ -118,30 +231,33 @@ func (c *Command) checkout(url string) (*git.Repository, error) {
 
 		// remove non-staged changes
 		if c.CleanUpWorkspace {
-			logrus.Info("Cleaning up workspace out of untracked files")
-			if resetErr := w.Reset(&git.ResetOptions{Mode: git.HardReset}); resetErr != nil {
-				logrus.Warningf("Failed to perform `git reset` on workspace: %s", resetErr.Error())
-			}
-			if cleanUpErr := w.Clean(&git.CleanOptions{}); cleanUpErr != nil {
-				logrus.Warningf("Failed to clean up workspace: %s", cleanUpErr.Error())
-			}
+			c.cleanUpWorkspace(repository)
 		}
 
+		// files downloaded from Git LFS are seen as changes to the committed pointer files, those need to be restored first
 		logrus.Infof("Doing checkout: hash=%v, branch=%v", hash, branch)
 		checkoutErr := w.Checkout(&git.CheckoutOptions{
-			Hash:   hash,
-			Branch: branch,
-			Keep:   false,
-			Create: false,
+			Hash:                      hash,
+			Branch:                    branch,
+			Keep:                      false,
+			Create:                    false,
+			Force:                     c.isSparse() || c.LFS,
+			SparseCheckoutDirectories: c.Sparse,
 		})
 		if checkoutErr != nil {
 			return repository, errors.Wrap(checkoutErr, "Cannot perform a `git checkout`")
 		}
 
-		if isBranch {
+		if isBranch && c.isSparse() {
+			if err := c.pullSparsely(repository, w, branch); err != nil {
+				return repository, errors.Wrap(err, "Cannot update sparse checkout to the latest commit of a branch")
+			}
+		} else if isBranch {
 			pullErr := w.Pull(&git.PullOptions{
 				RemoteName:    "origin",
 				ReferenceName: branch,
+				Depth:         c.Depth,
+				Auth:          auth,
 			})
 			if pullErr != nil {
 				if !strings.Contains(pullErr.Error(), "up-to-date") {
@@ -150,7 +266,10 @@ func (c *Command) checkout(url string) (*git.Repository, error) {
 			}
 		}
 
-		return repository, nil
+		if err := c.checkoutCommit(repository); err != nil {
+			return repository, err
+		}
+		return repository, c.checkoutSubmodules(repository)
 	} else {
 		logrus.Info("No local repository found, doing clone")
 
@@ -161,19 +280,108 @@ func (c *Command) checkout(url string) (*git.Repository, error) {
 			}
 		}
 
-		repository, err := git.PlainClone(c.Path, c.IsBare, &git.CloneOptions{
-			URL:      url,
-			Progress: os.Stdout,
-		})
+		reference, isReference, refErr := c.findRemoteReference(url, auth)
+		if refErr != nil {
+			return &git.Repository{}, refErr
+		}
+		if !isReference && !plumbing.IsHash(c.Revision) {
+			return &git.Repository{}, errors.Errorf("Revision '%s' is not a branch, a tag or a full commit hash in '%s'", c.Revision, c.Url)
+		}
+
+		options := &git.CloneOptions{
+			URL:          url,
+			Auth:         auth,
+			Progress:     os.Stdout,
+			Depth:        c.Depth,
+			SingleBranch: c.SingleBranch,
+			Tags:         c.tagMode(git.AllTags),
+		}
+		if isReference {
+			options.ReferenceName = reference
+		}
+		logrus.Infof("Cloning: reference=%v, depth=%v, singleBranch=%v, noTags=%v, sparse=%v", options.ReferenceName, c.Depth, c.SingleBranch, c.NoTags, c.Sparse)
+
+		repository, err := git.PlainClone(c.Path, c.IsBare, options)
 		if err != nil {
 			return repository, errors.Wrapf(err, "Cannot clone '%s' into '%s'", c.Url, c.Path)
 		}
-		return repository, nil
+
+		// a commit cannot be cloned directly, the default branch was cloned - the commit needs to be in its history (mind the --depth)
+		// sparse checkout is done after the clone, go-git applies it only on an already populated index
+		if (!isReference || c.isSparse()) && !c.IsBare {
+			w, worktreeErr := repository.Worktree()
+			if worktreeErr != nil {
+				return repository, errors.Wrap(worktreeErr, "Cannot retrieve a work tree for a `git checkout`")
+			}
+			checkoutOptions := &git.CheckoutOptions{Branch: reference, Force: c.isSparse(), SparseCheckoutDirectories: c.Sparse}
+			if !isReference {
+				checkoutOptions = &git.CheckoutOptions{Hash: plumbing.NewHash(c.Revision), Force: c.isSparse(), SparseCheckoutDirectories: c.Sparse}
+			}
+			if checkoutErr := w.Checkout(checkoutOptions); checkoutErr != nil {
+				return repository, errors.Wrapf(checkoutErr, "Cannot checkout '%s', when using --depth make sure the commit is within the history depth", c.Revision)
+			}
+		}
+		if err := c.checkoutCommit(repository); err != nil {
+			return repository, err
+		}
+		return repository, c.checkoutSubmodules(repository)
+	}
+}
+
+// checkoutCommit checks out the exact commit given with --commit (resolved from --rev at admission time), so all replicas use the same commit.
+// When somebody pushed in the meantime, then the commit must be within the fetched history
+func (c *Command) checkoutCommit(repository *git.Repository) error {
+	if c.Commit == "" || c.IsBare {
+		return nil
+	}
+	hash := plumbing.NewHash(c.Commit)
+	if head, err := repository.Head(); err == nil && head.Hash() == hash {
+		return nil
+	}
+	if _, err := repository.CommitObject(hash); err != nil {
+		return errors.Wrapf(err, "Commit '%s' resolved from '%s' was not fetched, when using --depth make sure the commit is within the history depth", c.Commit, c.Revision)
+	}
+
+	w, worktreeErr := repository.Worktree()
+	if worktreeErr != nil {
+		return errors.Wrap(worktreeErr, "Cannot retrieve a work tree for a `git checkout`")
+	}
+	logrus.Infof("Pinning checkout to commit '%s' resolved from '%s'", c.Commit, c.Revision)
+	if err := w.Checkout(&git.CheckoutOptions{Hash: hash, Force: c.isSparse() || c.LFS, SparseCheckoutDirectories: c.Sparse}); err != nil {
+		return errors.Wrapf(err, "Cannot checkout commit '%s'", c.Commit)
+	}
+	return nil
+}
+
+// checkoutSubmodules updates submodules to commits recorded in the checked out revision, when --recurse-submodules is enabled
+func (c *Command) checkoutSubmodules(repository *git.Repository) error {
+	if !c.RecurseSubmodules || c.IsBare {
+		return nil
+	}
+	if err := c.updateSubmodules(repository, c.Url, 1); err != nil {
+		return errors.Wrap(err, "Cannot update submodules")
+	}
+	return nil
+}
+
+// cleanUpWorkspace removes non-staged changes and untracked files, failures are only reported
+func (c *Command) cleanUpWorkspace(repository *git.Repository) {
+	logrus.Info("Cleaning up workspace out of untracked files")
+	w, worktreeErr := repository.Worktree()
+	if worktreeErr != nil {
+		logrus.Warningf("Failed to clean up workspace: %s", worktreeErr.Error())
+		return
+	}
+	if resetErr := w.ResetSparsely(&git.ResetOptions{Mode: git.HardReset}, c.Sparse); resetErr != nil {
+		logrus.Warningf("Failed to perform `git reset` on workspace: %s", resetErr.Error())
+	}
+	if cleanUpErr := w.Clean(&git.CleanOptions{}); cleanUpErr != nil {
+		logrus.Warningf("Failed to clean up workspace: %s", cleanUpErr.Error())
 	}
 }
 
 // fetch is making sure that the REMOTE is properly connected, then does a fetch on such remote
-func (c *Command) fetch(repository *git.Repository, remoteName string, url string) error {
+func (c *Command) fetch(repository *git.Repository, remoteName string, url string, auth transport.AuthMethod, refSpecs []config.RefSpec) error {
 	// make sure the remote is configured
 	remotes, _ := repository.Remotes()
 	found := false
@@ -184,8 +392,9 @@ func (c *Command) fetch(repository *git.Repository, remoteName string, url strin
 	}
 	if !found {
 		_, remoteCreationErr := repository.CreateRemote(&config.RemoteConfig{
-			Name: remoteName,
-			URLs: []string{url},
+			Name:  remoteName,
+			URLs:  []string{url},
+			Fetch: refSpecs,
 		})
 		if remoteCreationErr != nil {
 			return errors.Wrap(remoteCreationErr, "Cannot add remote URL to the local repository (`git remote add`)")
@@ -195,7 +404,10 @@ func (c *Command) fetch(repository *git.Repository, remoteName string, url strin
 	// fetch from configured remote 'origin'
 	fetchErr := repository.Fetch(&git.FetchOptions{
 		RemoteName: "origin",
-		Depth:      0,
+		RefSpecs:   refSpecs,
+		Depth:      c.Depth,
+		Tags:       c.tagMode(git.TagFollowing),
+		Auth:       auth,
 	})
 	if fetchErr != nil {
 		if strings.Contains(fetchErr.Error(), "up-to-date") {
@@ -209,6 +421,63 @@ func (c *Command) fetch(repository *git.Repository, remoteName string, url strin
 	return nil
 }
 
+// findRemoteReference resolves the revision into a full name of a branch or a tag by listing the remote (`git ls-remote`).
+// Second returned value is false, when the revision is not a branch or a tag - probably it is a commit
+func (c *Command) findRemoteReference(url string, auth transport.AuthMethod) (plumbing.ReferenceName, bool, error) {
+	if strings.Contains(c.Revision, "refs/") {
+		return plumbing.ReferenceName(c.Revision), true, nil
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: "origin", URLs: []string{url}})
+	refs, err := remote.List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", false, errors.Wrap(err, "Cannot list references of remote repository (`git ls-remote`)")
+	}
+
+	for _, candidate := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName(c.Revision), plumbing.NewTagReferenceName(c.Revision)} {
+		for _, ref := range refs {
+			if ref.Name() == candidate {
+				return candidate, true, nil
+			}
+		}
+	}
+	return "", false, nil
+}
+
+// createRefSpec creates a refspec fetching only a single branch or tag e.g. +refs/heads/main:refs/remotes/origin/main
+func createRefSpec(remoteName string, reference plumbing.ReferenceName) config.RefSpec {
+	if reference.IsBranch() {
+		return config.RefSpec(fmt.Sprintf("+%s:refs/remotes/%s/%s", reference, remoteName, reference.Short()))
+	}
+	return config.RefSpec(fmt.Sprintf("+%s:%s", reference, reference))
+}
+
+// isSparse tells if only selected paths should be present in the worktree
+func (c *Command) isSparse() bool {
+	return len(c.Sparse) > 0
+}
+
+// pullSparsely moves the local branch to the fetched commit and checks it out. `git pull` cannot be used, as go-git
+// does not recognize files skipped by the sparse checkout and considers those as unstaged deletions
+func (c *Command) pullSparsely(repository *git.Repository, w *git.Worktree, branch plumbing.ReferenceName) error {
+	remoteRef, err := repository.Reference(plumbing.NewRemoteReferenceName("origin", branch.Short()), true)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot find fetched branch '%s'", branch.Short())
+	}
+	if err := repository.Storer.SetReference(plumbing.NewHashReference(branch, remoteRef.Hash())); err != nil {
+		return errors.Wrapf(err, "Cannot update local branch '%s'", branch.Short())
+	}
+	return w.Checkout(&git.CheckoutOptions{Branch: branch, Force: true, SparseCheckoutDirectories: c.Sparse})
+}
+
+// tagMode returns git.NoTags when --no-tags was specified, else the given default
+func (c *Command) tagMode(defaultMode git.TagMode) git.TagMode {
+	if c.NoTags {
+		return git.NoTags
+	}
+	return defaultMode
+}
+
 // createReferenceName Creates a full reference name e.g. refs/tags/v4.0.2. Second arguments tells if this is a branch/tag=true or commit=false
 func (c *Command) createReferenceName(repository *git.Repository, ref string) (string, bool) {
 	if strings.Contains(ref, "refs/") {
@@ -235,6 +504,13 @@ func (c *Command) isExistingRepository() bool {
 
 // cleanUpRemotes removes all remotes from git repository to prevent token leak
 func (c *Command) cleanUpRemotes(repository *git.Repository) error {
+	// submodules first, as opening a fresh submodule repository requires the remote of its parent
+	if c.RecurseSubmodules && !c.IsBare {
+		if err := c.cleanUpSubmoduleRemotes(repository); err != nil {
+			return errors.Wrap(err, "Cannot remove remotes from submodules")
+		}
+	}
+
 	remotes, listingErr := repository.Remotes()
 	if listingErr != nil {
 		return listingErr
@@ -249,7 +525,7 @@ func (c *Command) cleanUpRemotes(repository *git.Repository) error {
 
 // getUrlWithCredentials makes sure that credentials are in the URL (token, username)
 func (c *Command) getUrlWithCredentials() (string, error) {
-	if strings.Contains(c.Url, "git@") {
+	if c.isSSHUrl() {
 		logrus.Infof("GIT-SSH url detected, not parsing the URL")
 		return c.Url, nil
 	}
@@ -276,13 +552,63 @@ func (c *Command) getUrlWithCredentials() (string, error) {
 	return fmt.Sprintf("%s://%s:%s@%s:%s/%s", u.Scheme, c.Username, c.Token, u.Hostname(), port, strings.TrimLeft(u.Path, "/")), nil
 }
 
+// isSSHUrl tells if the repository is accessed over SSH protocol e.g. git@github.com:riotkit-org/git-clone-controller.git
+func (c *Command) isSSHUrl() bool {
+	endpoint, err := transport.NewEndpoint(c.Url)
+	return err == nil && endpoint.Protocol == "ssh"
+}
+
+// getAuthMethod creates SSH public keys authorization with strict host key checking. HTTP(S) credentials are placed in the URL instead
+func (c *Command) getAuthMethod() (transport.AuthMethod, error) {
+	if !c.isSSHUrl() {
+		return nil, nil
+	}
+
+	endpoint, err := transport.NewEndpoint(c.Url)
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot parse GIT-SSH url")
+	}
+	user := endpoint.User
+	if user == "" {
+		user = "git"
+	}
+
+	var keys *gitssh.PublicKeys
+	var keyErr error
+	if c.SSHKeyPath != "" {
+		logrus.Infof("Using SSH private key from '%s'", c.SSHKeyPath)
+		keys, keyErr = gitssh.NewPublicKeysFromFile(user, c.SSHKeyPath, c.SSHKeyPassphrase)
+	} else if c.SSHKey != "" {
+		logrus.Info("Using SSH private key from GIT_SSH_KEY environment variable")
+		keys, keyErr = gitssh.NewPublicKeys(user, []byte(c.SSHKey), c.SSHKeyPassphrase)
+	} else {
+		return nil, errors.New("GIT-SSH url requires a private key, use --ssh-key-path or GIT_SSH_KEY environment variable")
+	}
+	if keyErr != nil {
+		return nil, errors.Wrap(keyErr, "Cannot load SSH private key")
+	}
+
+	// when no file is specified, then SSH_KNOWN_HOSTS environment variable or ~/.ssh/known_hosts are used
+	var knownHostsFiles []string
+	if c.KnownHostsPath != "" {
+		knownHostsFiles = append(knownHostsFiles, c.KnownHostsPath)
+	}
+	callback, callbackErr := gitssh.NewKnownHostsCallback(knownHostsFiles...)
+	if callbackErr != nil {
+		return nil, errors.Wrap(callbackErr, "Cannot load known_hosts, SSH host key cannot be verified")
+	}
+	keys.HostKeyCallback = callback
+
+	return keys, nil
+}
+
 // checkAndPrepareInputs performs a pre-validation and mutation of input parameters
 func (c *Command) checkAndPrepareInputs() error {
 	if c.Username == "" {
 		if os.Getenv("GIT_USER") != "" {
 			c.Username = os.Getenv("GIT_USER")
 		} else {
-			return errors.New("missing username")
+			c.Username = "__token__"
 		}
 	}
 	if c.Token == "" {
@@ -290,6 +616,29 @@ func (c *Command) checkAndPrepareInputs() error {
 			c.Token = os.Getenv("GIT_TOKEN")
 		}
 	}
+	if c.SSHKeyPath == "" && c.SSHKey == "" {
+		c.SSHKey = os.Getenv("GIT_SSH_KEY")
+	}
+	if c.SSHKeyPassphrase == "" {
+		c.SSHKeyPassphrase = os.Getenv("GIT_SSH_KEY_PASSPHRASE")
+	}
+	if c.Commit != "" && !plumbing.IsHash(c.Commit) {
+		return errors.Errorf("--commit must be a full commit hash, got '%s'", c.Commit)
+	}
+	if c.Chown != "" {
+		if _, _, err := parseOwnership(c.Chown); err != nil {
+			return err
+		}
+	}
+	if c.Chmod == "" {
+		c.Chmod = context.ChmodKeep
+	}
+	if _, known := chmodModes[c.Chmod]; !known && c.Chmod != context.ChmodKeep {
+		return errors.Errorf("--chmod has invalid value '%s', expected one of: %s", c.Chmod, strings.Join(context.ChmodPolicies, ", "))
+	}
+	if c.Chmod != context.ChmodKeep && c.Chown == "" {
+		return errors.New("--chmod can be used only together with --chown")
+	}
 	if c.Revision == "" {
 		if os.Getenv("GIT_REVISION") != "" {
 			c.Revision = os.Getenv("GIT_REVISION")
@@ -1,7 +1,16 @@
 package checkout
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"net"
+	"os"
 	"testing"
 )
 
@@ -43,3 +52,51 @@ func TestGetUrlWithCredentials_GIT(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "git@github.com:riotkit-org/git-clone-controller.git", url)
 }
+
+func TestGetAuthMethod_HTTPSDoesNotUseSSH(t *testing.T) {
+	for _, url := range []string{"https://git.myexample.org/example/wordpress-theme.git", "https://git@git.myexample.org/example/wordpress-theme.git"} {
+		c := Command{Url: url}
+
+		auth, err := c.getAuthMethod()
+		assert.Nil(t, err)
+		assert.Nil(t, auth)
+	}
+}
+
+func TestGetAuthMethod_SSHRequiresPrivateKey(t *testing.T) {
+	c := Command{Url: "git@github.com:riotkit-org/git-clone-controller.git"}
+
+	_, err := c.getAuthMethod()
+	assert.Contains(t, err.Error(), "GIT-SSH url requires a private key")
+}
+
+func TestGetAuthMethod_SSHWithPrivateKeyAndKnownHosts(t *testing.T) {
+	dir := t.TempDir()
+
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	assert.Nil(t, os.WriteFile(dir+"/identity", keyPem, 0600))
+
+	publicKey, _ := ssh.NewPublicKey(&privateKey.PublicKey)
+	knownHosts := knownhosts.Line([]string{"git.myexample.org"}, publicKey)
+	assert.Nil(t, os.WriteFile(dir+"/known_hosts", []byte(knownHosts+"\n"), 0600))
+
+	c := Command{
+		Url:            "ssh://deploy@git.myexample.org/example/wordpress-theme.git",
+		SSHKeyPath:     dir + "/identity",
+		KnownHostsPath: dir + "/known_hosts",
+	}
+
+	auth, err := c.getAuthMethod()
+	assert.Nil(t, err)
+
+	keys := auth.(*gitssh.PublicKeys)
+	assert.Equal(t, "deploy", keys.User)
+
+	// known host is accepted, other host keys are rejected
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherPublicKey, _ := ssh.NewPublicKey(&otherKey.PublicKey)
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+	assert.Nil(t, keys.HostKeyCallback("git.myexample.org:22", addr, publicKey))
+	assert.NotNil(t, keys.HostKeyCallback("git.myexample.org:22", addr, otherPublicKey))
+}
@@ -1,11 +1,20 @@
 package checkout_test
 
 import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/riotkit-org/git-clone-controller/cmd/checkout"
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/riotkit-org/git-clone-controller/pkg/report"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"syscall"
 	"testing"
+	"time"
 )
 
 // TestCommand_Run makes a simple functional test - clone, then make a checkout to other reference
@@ -124,3 +133,214 @@ func TestCommandRunWithDirtyWorkspaceOnSecondCheckout(t *testing.T) {
 	assert.FileExists(t, dir+"/Makefile", "This file should be back")
 	assert.NoFileExists(t, dir+"/somefile.txt", "This file should be removed by clean up & pull")
 }
+
+// TestCommandRunShallowCloneThenUpdate clones a local repository with limited history, then fetches new commits into the shallow repository
+func TestCommandRunShallowCloneThenUpdate(t *testing.T) {
+	remoteDir := t.TempDir()
+	remote, _ := git.PlainInit(remoteDir, false)
+	commitFile(t, remote, remoteDir, "index.html", "first")
+	commitFile(t, remote, remoteDir, "index.html", "second")
+
+	dir := t.TempDir()
+	c := checkout.Command{
+		Path:             dir,
+		Url:              "file://" + remoteDir,
+		Revision:         "master",
+		CleanUpRemotes:   true,
+		CleanUpWorkspace: true,
+		Depth:            1,
+		SingleBranch:     true,
+		NoTags:           true,
+	}
+
+	// Step 1: shallow clone
+	assert.Nil(t, c.Run())
+	assert.Equal(t, 1, countCommits(t, dir), "Expected only one commit in the history")
+
+	// Step 2: incremental fetch into the shallow repository
+	third := commitFile(t, remote, remoteDir, "index.html", "third")
+	assert.Nil(t, c.Run())
+
+	content, _ := os.ReadFile(dir + "/index.html")
+	assert.Equal(t, "third", string(content))
+	local, _ := git.PlainOpen(dir)
+	head, _ := local.Head()
+	assert.Equal(t, third, head.Hash().String())
+}
+
+// TestCommandRunPinnedCommit checks out a commit resolved earlier, even when the branch moved forward in the meantime
+func TestCommandRunPinnedCommit(t *testing.T) {
+	remoteDir := t.TempDir()
+	remote, _ := git.PlainInit(remoteDir, false)
+	pinned := commitFile(t, remote, remoteDir, "index.html", "first")
+	commitFile(t, remote, remoteDir, "index.html", "pushed during a rollout")
+
+	dir := t.TempDir()
+	c := checkout.Command{
+		Path:             dir,
+		Url:              "file://" + remoteDir,
+		Revision:         "master",
+		Commit:           pinned,
+		CleanUpRemotes:   true,
+		CleanUpWorkspace: true,
+	}
+	assert.Nil(t, c.Run())
+
+	content, _ := os.ReadFile(dir + "/index.html")
+	assert.Equal(t, "first", string(content))
+	local, _ := git.PlainOpen(dir)
+	head, _ := local.Head()
+	assert.Equal(t, pinned, head.Hash().String())
+
+	// the checkout is reported in the termination message
+	c.TerminationMessagePath = t.TempDir() + "/termination-log"
+	assert.Nil(t, c.Run())
+	message, _ := os.ReadFile(c.TerminationMessagePath)
+	summary, summaryErr := report.ParseSummary(string(message))
+	assert.Nil(t, summaryErr)
+	assert.Equal(t, pinned, summary.Commit)
+	assert.Equal(t, "master", summary.Ref)
+	assert.Equal(t, "file://"+remoteDir, summary.Url)
+
+	// the commit is not within fetched history
+	c.TerminationMessagePath = ""
+	c.Path = t.TempDir()
+	c.Depth = 1
+	assert.ErrorContains(t, c.Run(), "was not fetched")
+}
+
+// TestCommandRunChownThenUpdate updates a worktree that a previous checkout already handed over to other user
+func TestCommandRunChownThenUpdate(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Handing files over to other user requires root")
+	}
+	remoteDir := t.TempDir()
+	remote, _ := git.PlainInit(remoteDir, false)
+	commitFile(t, remote, remoteDir, "index.html", "first")
+
+	dir := t.TempDir()
+	c := checkout.Command{
+		Path:             dir,
+		Url:              "file://" + remoteDir,
+		Revision:         "master",
+		CleanUpRemotes:   true,
+		CleanUpWorkspace: true,
+		Chown:            "1000:1001",
+		ChownGitDir:      true,
+		Chmod:            context.ChmodPrivate,
+	}
+	owner := func(path string) (uint32, uint32) {
+		info, err := os.Lstat(dir + "/" + path)
+		assert.Nil(t, err)
+		stat := info.Sys().(*syscall.Stat_t)
+		return stat.Uid, stat.Gid
+	}
+
+	// Step 1: clone, then hand over
+	assert.Nil(t, c.Run())
+	uid, gid := owner(".git/HEAD")
+	assert.Equal(t, []uint32{1000, 1001}, []uint32{uid, gid})
+
+	// Step 2: the files are taken back before the update, then handed over again
+	commitFile(t, remote, remoteDir, "index.html", "second")
+	assert.Nil(t, c.Run())
+	content, _ := os.ReadFile(dir + "/index.html")
+	assert.Equal(t, "second", string(content))
+	uid, gid = owner("index.html")
+	assert.Equal(t, []uint32{1000, 1001}, []uint32{uid, gid})
+}
+
+// commitFile creates a commit in a local "remote" repository
+func commitFile(t *testing.T, repository *git.Repository, dir string, name string, content string) string {
+	assert.Nil(t, os.WriteFile(dir+"/"+name, []byte(content), 0644))
+	w, _ := repository.Worktree()
+	_, _ = w.Add(name)
+	hash, err := w.Commit("Update "+name, &git.CommitOptions{Author: &object.Signature{Name: "Kropotkin", Email: "peter@example.org", When: time.Now()}})
+	assert.Nil(t, err)
+	return hash.String()
+}
+
+func countCommits(t *testing.T, dir string) int {
+	repository, _ := git.PlainOpen(dir)
+	commits, err := repository.Log(&git.LogOptions{})
+	assert.Nil(t, err)
+	count := 0
+	_ = commits.ForEach(func(*object.Commit) error {
+		count++
+		return nil
+	})
+	return count
+}
+
+// TestCommandRunSparseCheckoutThenUpdate checks out only a single directory, then updates it to a newer commit
+func TestCommandRunSparseCheckoutThenUpdate(t *testing.T) {
+	remoteDir := t.TempDir()
+	remote, _ := git.PlainInit(remoteDir, false)
+	assert.Nil(t, os.MkdirAll(remoteDir+"/themes/iwa", 0755))
+	assert.Nil(t, os.MkdirAll(remoteDir+"/plugins", 0755))
+	commitFile(t, remote, remoteDir, "themes/iwa/style.css", "first")
+	commitFile(t, remote, remoteDir, "plugins/cache.php", "<?php")
+
+	dir := t.TempDir()
+	c := checkout.Command{
+		Path:             dir,
+		Url:              "file://" + remoteDir,
+		Revision:         "master",
+		CleanUpRemotes:   true,
+		CleanUpWorkspace: true,
+		Sparse:           []string{"themes/iwa"},
+	}
+
+	// Step 1: clone
+	assert.Nil(t, c.Run())
+	assert.FileExists(t, dir+"/themes/iwa/style.css")
+	assert.NoFileExists(t, dir+"/plugins/cache.php")
+
+	// Step 2: update
+	commitFile(t, remote, remoteDir, "themes/iwa/style.css", "second")
+	assert.Nil(t, c.Run())
+
+	content, _ := os.ReadFile(dir + "/themes/iwa/style.css")
+	assert.Equal(t, "second", string(content))
+	assert.NoFileExists(t, dir+"/plugins/cache.php")
+}
+
+// TestCommandRunWithSubmodules clones a repository with a submodule referenced by a relative url, then updates a dirty submodule worktree
+func TestCommandRunWithSubmodules(t *testing.T) {
+	root := t.TempDir()
+	plugin, _ := git.PlainInit(root+"/plugin", false)
+	pluginCommit := commitFile(t, plugin, root+"/plugin", "cache.php", "<?php")
+
+	parent, _ := git.PlainInit(root+"/parent", false)
+	idx, _ := parent.Storer.Index()
+	idx.Entries = append(idx.Entries, &index.Entry{Name: "plugins/cache", Hash: plumbing.NewHash(pluginCommit), Mode: filemode.Submodule})
+	assert.Nil(t, parent.Storer.SetIndex(idx))
+	commitFile(t, parent, root+"/parent", ".gitmodules", "[submodule \"cache\"]\n\tpath = plugins/cache\n\turl = ../plugin\n")
+
+	dir := t.TempDir()
+	c := checkout.Command{
+		Path:              dir,
+		Url:               "file://" + root + "/parent",
+		Revision:          "master",
+		CleanUpRemotes:    true,
+		CleanUpWorkspace:  true,
+		RecurseSubmodules: true,
+		SubmodulesDepth:   10,
+	}
+
+	// Step 1: clone
+	assert.Nil(t, c.Run())
+	assert.FileExists(t, dir+"/plugins/cache/cache.php")
+
+	local, _ := git.PlainOpen(dir)
+	w, _ := local.Worktree()
+	submodule, _ := w.Submodule("cache")
+	subRepository, _ := submodule.Repository()
+	remotes, _ := subRepository.Remotes()
+	assert.Empty(t, remotes, "Remotes of submodules should be also removed")
+
+	// Step 2: update with a dirty submodule worktree
+	assert.Nil(t, os.Remove(dir+"/plugins/cache/cache.php"))
+	assert.Nil(t, c.Run())
+	assert.FileExists(t, dir+"/plugins/cache/cache.php")
+}
@@ -0,0 +1,102 @@
+package checkout
+
+import (
+	"github.com/pkg/errors"
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/sirupsen/logrus"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// chmodModes are permissions of directories and files for each context.ChmodPolicy
+var chmodModes = map[string]struct{ directory, file fs.FileMode }{
+	context.ChmodPrivate:       {0700, 0600},
+	context.ChmodGroupReadable: {0750, 0640},
+	context.ChmodGroupWritable: {0770, 0660},
+	context.ChmodWorldReadable: {0755, 0644},
+}
+
+// parseOwnership parses "uid:gid" of --chown
+func parseOwnership(value string) (int, int, error) {
+	owner, group, found := strings.Cut(value, ":")
+	uid, uidErr := strconv.Atoi(owner)
+	gid, gidErr := strconv.Atoi(group)
+	if !found || uidErr != nil || gidErr != nil || uid < 0 || gid < 0 {
+		return 0, 0, errors.Errorf("--chown must be numeric 'uid:gid', got '%s'", value)
+	}
+	return uid, gid, nil
+}
+
+// applyOwnership hands the worktree over to --chown owner and applies --chmod policy.
+// `.git` is left to the checkout's user (root), unless --chown-git-dir is set
+func (c *Command) applyOwnership() error {
+	uid, gid, err := parseOwnership(c.Chown)
+	if err != nil {
+		return err
+	}
+	modes, changesModes := chmodModes[c.Chmod]
+	logrus.Infof("Changing owner of '%s' to %d:%d (chmod policy: %s, including .git: %v)", c.Path, uid, gid, c.Chmod, c.ChownGitDir)
+
+	return filepath.WalkDir(c.Path, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		// submodules have `.git` files, nested repositories have `.git` directories
+		if entry.Name() == ".git" && !c.ChownGitDir {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err := os.Lchown(path, uid, gid); err != nil {
+			return errors.Wrapf(err, "cannot chown '%s'", path)
+		}
+		// permissions of symbolic links are not used on Linux
+		if !changesModes || entry.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, infoErr := entry.Info()
+		if infoErr != nil {
+			return infoErr
+		}
+		if err := os.Chmod(path, policyMode(info.Mode(), modes.directory, modes.file)); err != nil {
+			return errors.Wrapf(err, "cannot chmod '%s'", path)
+		}
+		return nil
+	})
+}
+
+// reclaimOwnership hands files of a previous checkout back to the checkout's user (root) before the update.
+// Only CAP_CHOWN is granted, without it files already handed over to the owner could not be written
+func (c *Command) reclaimOwnership() error {
+	if _, err := os.Lstat(c.Path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+	logrus.Infof("Changing owner of '%s' to %d:%d before the update", c.Path, uid, gid)
+
+	// a directory is handed over before it is listed, so also private modes can be walked through
+	return filepath.WalkDir(c.Path, func(path string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if err := os.Lchown(path, uid, gid); err != nil {
+			return errors.Wrapf(err, "cannot chown '%s'", path)
+		}
+		return nil
+	})
+}
+
+// policyMode returns permissions for a directory or a file. Executable files keep the execute bit wherever they are readable
+func policyMode(current fs.FileMode, directory fs.FileMode, file fs.FileMode) fs.FileMode {
+	if current.IsDir() {
+		return directory
+	}
+	if current.Perm()&0100 != 0 {
+		return file | (file&0444)>>2
+	}
+	return file
+}
@@ -0,0 +1,90 @@
+package checkout
+
+import (
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestPolicyMode(t *testing.T) {
+	assert.Equal(t, fs.FileMode(0750), policyMode(fs.ModeDir|0700, 0750, 0640))
+	assert.Equal(t, fs.FileMode(0640), policyMode(0644, 0750, 0640))
+	assert.Equal(t, fs.FileMode(0750), policyMode(0755, 0750, 0640), "Executable should stay executable wherever readable")
+	assert.Equal(t, fs.FileMode(0770), policyMode(0700, 0770, 0660))
+}
+
+func TestParseOwnership(t *testing.T) {
+	uid, gid, err := parseOwnership("1000:33")
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, uid)
+	assert.Equal(t, 33, gid)
+
+	for _, invalid := range []string{"1000", "www-data:www-data", "-1:0", ""} {
+		_, _, parseErr := parseOwnership(invalid)
+		assert.NotNil(t, parseErr, invalid)
+	}
+}
+
+func TestApplyOwnership(t *testing.T) {
+	workspace := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(workspace, ".git", "objects"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(workspace, "bin"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(workspace, "index.html"), []byte("hello"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(workspace, "bin", "run.sh"), []byte("#!/bin/sh"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(workspace, ".git", "HEAD"), []byte("ref: refs/heads/main"), 0644))
+	assert.Nil(t, os.Symlink("index.html", filepath.Join(workspace, "link.html")))
+
+	// handing over to the current user is allowed without CAP_CHOWN
+	c := Command{
+		Path:  workspace,
+		Chown: strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid()),
+		Chmod: context.ChmodGroupWritable,
+	}
+	assert.Nil(t, c.applyOwnership())
+
+	mode := func(path string) fs.FileMode {
+		info, err := os.Stat(filepath.Join(workspace, path))
+		assert.Nil(t, err)
+		return info.Mode().Perm()
+	}
+	assert.Equal(t, fs.FileMode(0660), mode("index.html"))
+	assert.Equal(t, fs.FileMode(0770), mode("bin"))
+	assert.Equal(t, fs.FileMode(0770), mode("bin/run.sh"))
+	assert.Equal(t, fs.FileMode(0644), mode(".git/HEAD"), "Expected that .git is skipped without --chown-git-dir")
+
+	c.ChownGitDir = true
+	assert.Nil(t, c.applyOwnership())
+	assert.Equal(t, fs.FileMode(0660), mode(".git/HEAD"))
+}
+
+func TestReclaimOwnership(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Handing files over to other user requires root")
+	}
+	workspace := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(workspace, "private"), 0700))
+	assert.Nil(t, os.WriteFile(filepath.Join(workspace, "private", "index.html"), []byte("hello"), 0600))
+	c := Command{Path: workspace, Chown: "1000:1000", Chmod: context.ChmodPrivate}
+	assert.Nil(t, c.applyOwnership())
+
+	assert.Nil(t, c.reclaimOwnership())
+	info, err := os.Stat(filepath.Join(workspace, "private", "index.html"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(os.Getuid()), info.Sys().(*syscall.Stat_t).Uid)
+
+	missing := Command{Path: filepath.Join(workspace, "not-cloned-yet")}
+	assert.Nil(t, missing.reclaimOwnership())
+}
+
+func TestCheckAndPrepareInputs_ChmodRequiresChown(t *testing.T) {
+	c := Command{Chmod: context.ChmodPrivate}
+	assert.EqualError(t, c.checkAndPrepareInputs(), "--chmod can be used only together with --chown")
+
+	c = Command{Chown: "1000:1000", Chmod: "0777"}
+	assert.Contains(t, c.checkAndPrepareInputs().Error(), "--chmod has invalid value '0777'")
+}
@@ -0,0 +1,156 @@
+package checkout
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"path"
+	"strings"
+)
+
+// updateSubmodules initializes and updates submodules of given repository, then goes into nested submodules up to --submodules-depth.
+// Submodules are updated one-by-one, so the credentials are given only to submodules placed on the same host as the parent repository
+func (c *Command) updateSubmodules(repository *git.Repository, parentUrl string, level int) error {
+	if level > c.SubmodulesDepth {
+		logrus.Infof("Not going deeper into submodules of '%s', maximum depth of %v reached", parentUrl, c.SubmodulesDepth)
+		return nil
+	}
+
+	w, worktreeErr := repository.Worktree()
+	if worktreeErr != nil {
+		return errors.Wrap(worktreeErr, "Cannot retrieve a work tree to list submodules")
+	}
+	submodules, listErr := w.Submodules()
+	if listErr != nil {
+		return errors.Wrap(listErr, "Cannot list submodules (`.gitmodules`)")
+	}
+
+	for _, submodule := range submodules {
+		name := submodule.Config().Name
+		if !c.isInSparsePaths(submodule.Config().Path) {
+			logrus.Infof("Skipping submodule '%s', it is not within sparse checkout paths", name)
+			continue
+		}
+
+		logrus.Infof("Updating submodule '%s' at '%s'", name, submodule.Config().Path)
+		if err := submodule.Init(); err != nil && !errors.Is(err, git.ErrSubmoduleAlreadyInitialized) {
+			return errors.Wrapf(err, "Cannot initialize submodule '%s'", name)
+		}
+
+		submoduleUrl, resolveErr := resolveSubmoduleUrl(parentUrl, submodule.Config().URL)
+		if resolveErr != nil {
+			return errors.Wrapf(resolveErr, "Cannot resolve url of submodule '%s'", name)
+		}
+		urlWithCredentials, auth, credentialsErr := c.getSubmoduleCredentials(parentUrl, submoduleUrl)
+		if credentialsErr != nil {
+			return errors.Wrapf(credentialsErr, "Cannot prepare credentials for submodule '%s'", name)
+		}
+
+		subRepository, repositoryErr := submodule.Repository()
+		if repositoryErr != nil {
+			return errors.Wrapf(repositoryErr, "Cannot open repository of submodule '%s'", name)
+		}
+		if c.CleanUpWorkspace {
+			c.cleanUpWorkspace(subRepository)
+		}
+
+		// the remote could be deleted by --clean-remotes, or could contain outdated credentials
+		_ = subRepository.DeleteRemote("origin")
+		if _, err := subRepository.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{urlWithCredentials}}); err != nil {
+			return errors.Wrapf(err, "Cannot add remote URL to submodule '%s'", name)
+		}
+
+		updateErr := submodule.Update(&git.SubmoduleUpdateOptions{Auth: auth, Depth: c.Depth})
+		if updateErr != nil {
+			return errors.Wrapf(updateErr, "Cannot update submodule '%s' from '%s'", name, submoduleUrl)
+		}
+
+		if err := c.updateSubmodules(subRepository, submoduleUrl, level+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanUpSubmoduleRemotes removes remotes from all initialized submodules, including nested ones
+func (c *Command) cleanUpSubmoduleRemotes(repository *git.Repository) error {
+	w, worktreeErr := repository.Worktree()
+	if worktreeErr != nil {
+		return worktreeErr
+	}
+	submodules, listErr := w.Submodules()
+	if listErr != nil {
+		return listErr
+	}
+	for _, submodule := range submodules {
+		subRepository, err := submodule.Repository()
+		if errors.Is(err, git.ErrSubmoduleNotInitialized) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Cannot open repository of submodule '%s'", submodule.Config().Name)
+		}
+		if err := c.cleanUpRemotes(subRepository); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getSubmoduleCredentials returns url with credentials and SSH authorization, when the submodule is placed on the same host as its parent.
+// Other hosts are accessed anonymously
+func (c *Command) getSubmoduleCredentials(parentUrl string, submoduleUrl string) (string, transport.AuthMethod, error) {
+	parent, parentErr := transport.NewEndpoint(parentUrl)
+	if parentErr != nil {
+		return "", nil, parentErr
+	}
+	endpoint, endpointErr := transport.NewEndpoint(submoduleUrl)
+	if endpointErr != nil {
+		return "", nil, endpointErr
+	}
+	if parent.Host != endpoint.Host {
+		logrus.Infof("Submodule '%s' is placed on other host than '%s', not using credentials", submoduleUrl, parent.Host)
+		return submoduleUrl, nil, nil
+	}
+
+	// same credentials, different url
+	sub := *c
+	sub.Url = submoduleUrl
+	urlWithCredentials, err := sub.getUrlWithCredentials()
+	if err != nil {
+		return "", nil, err
+	}
+	auth, authErr := sub.getAuthMethod()
+	if authErr != nil {
+		return "", nil, authErr
+	}
+	return urlWithCredentials, auth, nil
+}
+
+// resolveSubmoduleUrl resolves relative submodule url (e.g. "../plugins.git") against the parent repository url
+func resolveSubmoduleUrl(parentUrl string, submoduleUrl string) (string, error) {
+	if !strings.HasPrefix(submoduleUrl, "./") && !strings.HasPrefix(submoduleUrl, "../") {
+		return submoduleUrl, nil
+	}
+	endpoint, err := transport.NewEndpoint(parentUrl)
+	if err != nil {
+		return "", err
+	}
+	endpoint.Path = path.Join(endpoint.Path, submoduleUrl)
+	return endpoint.String(), nil
+}
+
+// isInSparsePaths tells if given path is checked out, when the checkout is sparse
+func (c *Command) isInSparsePaths(subPath string) bool {
+	if !c.isSparse() {
+		return true
+	}
+	for _, sparse := range c.Sparse {
+		if subPath == sparse || strings.HasPrefix(subPath, sparse+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package checkout
+
+import (
+	"bytes"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// verifySignature verifies the signature of the checked out tag (when the revision is a signed, annotated tag) or of the HEAD commit
+func (c *Command) verifySignature(repository *git.Repository) error {
+	keyRing, keyRingErr := readArmoredKeyRing(c.VerifyKeysPath)
+	if keyRingErr != nil {
+		return errors.Wrapf(keyRingErr, "Cannot read public keys from '%s'", c.VerifyKeysPath)
+	}
+
+	head, headErr := repository.Head()
+	if headErr != nil {
+		return errors.Wrap(headErr, "Cannot read HEAD of local repository")
+	}
+
+	if tag := c.findAnnotatedTag(repository); tag != nil && tag.PGPSignature != "" {
+		commit, err := tag.Commit()
+		if err != nil || commit.Hash != head.Hash() {
+			return errors.Errorf("Tag '%s' does not point to the checked out commit '%s'", tag.Name, head.Hash())
+		}
+		entity, verifyErr := tag.Verify(keyRing)
+		if verifyErr != nil {
+			return errors.Wrapf(verifyErr, "Tag '%s' is signed by an unknown key or the signature is invalid", tag.Name)
+		}
+		logrus.Infof("Tag '%s' is signed by '%s'", tag.Name, identityName(entity))
+		return nil
+	}
+
+	commit, commitErr := repository.CommitObject(head.Hash())
+	if commitErr != nil {
+		return errors.Wrapf(commitErr, "Cannot read HEAD commit '%s'", head.Hash())
+	}
+	if commit.PGPSignature == "" {
+		return errors.Errorf("HEAD commit '%s' is not signed, refusing to use it", commit.Hash)
+	}
+	entity, verifyErr := commit.Verify(keyRing)
+	if verifyErr != nil {
+		return errors.Wrapf(verifyErr, "HEAD commit '%s' is signed by an unknown key or the signature is invalid", commit.Hash)
+	}
+	logrus.Infof("HEAD commit '%s' is signed by '%s'", commit.Hash, identityName(entity))
+	return nil
+}
+
+// findAnnotatedTag returns the tag object, when the revision is an annotated tag
+func (c *Command) findAnnotatedTag(repository *git.Repository) *object.Tag {
+	ref, err := repository.Tag(strings.TrimPrefix(c.Revision, "refs/tags/"))
+	if err != nil {
+		return nil
+	}
+	tag, err := repository.TagObject(ref.Hash())
+	if err != nil {
+		return nil
+	}
+	return tag
+}
+
+// readArmoredKeyRing reads a single file, or all files from a directory e.g. a mounted ConfigMap (`..data` entries are skipped)
+func readArmoredKeyRing(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files = []string{}
+		entries, readErr := os.ReadDir(path)
+		if readErr != nil {
+			return "", readErr
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), "..") {
+				continue
+			}
+			// mounted ConfigMap entries are symbolic links
+			if stat, statErr := os.Stat(filepath.Join(path, entry.Name())); statErr != nil || stat.IsDir() {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+
+	// each file is a separate armored block, `Verify()` accepts only a single one
+	var keyRing openpgp.EntityList
+	for _, file := range files {
+		content, readErr := os.ReadFile(file)
+		if readErr != nil {
+			return "", readErr
+		}
+		entities, parseErr := openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+		if parseErr != nil {
+			return "", errors.Wrapf(parseErr, "Cannot parse armored public key '%s'", file)
+		}
+		keyRing = append(keyRing, entities...)
+	}
+	if len(keyRing) == 0 {
+		return "", errors.New("no public keys found")
+	}
+
+	var buffer bytes.Buffer
+	writer, armorErr := armor.Encode(&buffer, openpgp.PublicKeyType, nil)
+	if armorErr != nil {
+		return "", armorErr
+	}
+	for _, entity := range keyRing {
+		if err := entity.Serialize(writer); err != nil {
+			return "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// identityName returns any identity of the key, used for logging
+func identityName(entity *openpgp.Entity) string {
+	for name := range entity.Identities {
+		return name
+	}
+	return entity.PrimaryKey.KeyIdString()
+}
@@ -0,0 +1,96 @@
+package checkout
+
+import (
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// createKeyPair generates a PGP key, writes the armored public key into given directory
+func createKeyPair(t *testing.T, dir string, name string) *openpgp.Entity {
+	entity, err := openpgp.NewEntity(name, "", name+"@example.org", nil)
+	assert.Nil(t, err)
+
+	file, _ := os.Create(filepath.Join(dir, name+".asc"))
+	writer, _ := armor.Encode(file, openpgp.PublicKeyType, nil)
+	assert.Nil(t, entity.Serialize(writer))
+	assert.Nil(t, writer.Close())
+	assert.Nil(t, file.Close())
+	return entity
+}
+
+// createCommit makes a commit in a new repository, signed when the key is not nil
+func createCommit(t *testing.T, key *openpgp.Entity) (*git.Repository, string) {
+	dir := t.TempDir()
+	repository, _ := git.PlainInit(dir, false)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "job.sh"), []byte("echo 'Direct action'"), 0755))
+	w, _ := repository.Worktree()
+	_, _ = w.Add("job.sh")
+	_, err := w.Commit("Add job", &git.CommitOptions{
+		Author:  &object.Signature{Name: "Kropotkin", Email: "peter@example.org", When: time.Now()},
+		SignKey: key,
+	})
+	assert.Nil(t, err)
+	return repository, dir
+}
+
+func TestVerifySignature_SignedCommit(t *testing.T) {
+	keys := t.TempDir()
+	key := createKeyPair(t, keys, "kropotkin")
+	createKeyPair(t, keys, "bakunin")
+	// ConfigMap volumes contain `..data` directories
+	assert.Nil(t, os.Mkdir(filepath.Join(keys, "..data"), 0755))
+
+	repository, dir := createCommit(t, key)
+	c := Command{Path: dir, Revision: "master", VerifyKeysPath: keys}
+
+	assert.Nil(t, c.verifySignature(repository))
+}
+
+func TestVerifySignature_UnsignedCommit(t *testing.T) {
+	keys := t.TempDir()
+	createKeyPair(t, keys, "kropotkin")
+
+	repository, dir := createCommit(t, nil)
+	c := Command{Path: dir, Revision: "master", VerifyKeysPath: keys}
+
+	err := c.verifySignature(repository)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "is not signed")
+}
+
+func TestVerifySignature_UnknownKey(t *testing.T) {
+	keys := t.TempDir()
+	createKeyPair(t, keys, "kropotkin")
+	unknown, _ := openpgp.NewEntity("makhno", "", "nestor@example.org", nil)
+
+	repository, dir := createCommit(t, unknown)
+	c := Command{Path: dir, Revision: "master", VerifyKeysPath: keys + "/kropotkin.asc"}
+
+	err := c.verifySignature(repository)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "signed by an unknown key")
+}
+
+func TestVerifySignature_SignedTag(t *testing.T) {
+	keys := t.TempDir()
+	key := createKeyPair(t, keys, "kropotkin")
+
+	repository, dir := createCommit(t, nil)
+	head, _ := repository.Head()
+	_, err := repository.CreateTag("v1.0.0", head.Hash(), &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "Kropotkin", Email: "peter@example.org", When: time.Now()},
+		Message: "Release",
+		SignKey: key,
+	})
+	assert.Nil(t, err)
+
+	c := Command{Path: dir, Revision: "v1.0.0", VerifyKeysPath: keys}
+	assert.Nil(t, c.verifySignature(repository), "Signed tag should be enough, even if the commit is not signed")
+}
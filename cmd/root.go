@@ -3,6 +3,7 @@ package cmd
 import (
 	"github.com/riotkit-org/git-clone-controller/cmd/checkout"
 	"github.com/riotkit-org/git-clone-controller/cmd/serve"
+	"github.com/riotkit-org/git-clone-controller/cmd/sync"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -32,6 +33,7 @@ func Main() *cobra.Command {
 	}
 	cmd.AddCommand(serve.NewServeCommand())
 	cmd.AddCommand(checkout.NewCheckoutCommand())
+	cmd.AddCommand(sync.NewSyncCommand())
 	cmd.AddCommand(NewCheckCommand())
 
 	return cmd
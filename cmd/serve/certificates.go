@@ -0,0 +1,135 @@
+package serve
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// certificateReloader serves the webhook certificate from files and swaps it, when the files change (e.g. cert-manager renewed the Secret).
+// Files are polled, as Secret volumes are updated by replacing a symlink, which is not reliably reported by file notifications
+type certificateReloader struct {
+	certPath string
+	keyPath  string
+	caPath   string
+
+	certificate atomic.Pointer[tls.Certificate]
+	clientCAs   atomic.Pointer[x509.CertPool]
+	checksum    [sha256.Size]byte
+}
+
+// newCertificateReloader loads certificate from given paths. CA is optional, when set then clients have to present a certificate signed by it
+func newCertificateReloader(certPath string, keyPath string, caPath string) (*certificateReloader, error) {
+	r := &certificateReloader{certPath: certPath, keyPath: keyPath, caPath: caPath}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// newStaticCertificate serves a certificate, that is not read from files - it is replaced using store()
+func newStaticCertificate(certificate *tls.Certificate) *certificateReloader {
+	r := &certificateReloader{}
+	r.store(certificate)
+	return r
+}
+
+// store swaps the served certificate
+func (r *certificateReloader) store(certificate *tls.Certificate) {
+	r.certificate.Store(certificate)
+}
+
+// reload reads the files and swaps the certificate, when their content changed. On error the previous certificate is kept
+func (r *certificateReloader) reload() (bool, error) {
+	certPEM, certErr := os.ReadFile(r.certPath)
+	if certErr != nil {
+		return false, errors.Wrapf(certErr, "cannot read TLS certificate '%s'", r.certPath)
+	}
+	keyPEM, keyErr := os.ReadFile(r.keyPath)
+	if keyErr != nil {
+		return false, errors.Wrapf(keyErr, "cannot read TLS key '%s'", r.keyPath)
+	}
+	var caPEM []byte
+	if r.caPath != "" {
+		var caErr error
+		if caPEM, caErr = os.ReadFile(r.caPath); caErr != nil {
+			return false, errors.Wrapf(caErr, "cannot read TLS CA '%s'", r.caPath)
+		}
+	}
+
+	checksum := sha256.Sum256(append(append(append([]byte{}, certPEM...), keyPEM...), caPEM...))
+	if r.certificate.Load() != nil && checksum == r.checksum {
+		return false, nil
+	}
+
+	certificate, pairErr := tls.X509KeyPair(certPEM, keyPEM)
+	if pairErr != nil {
+		return false, errors.Wrapf(pairErr, "cannot load TLS certificate '%s' with key '%s'", r.certPath, r.keyPath)
+	}
+	if len(caPEM) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return false, errors.Errorf("TLS CA '%s' does not contain any PEM encoded certificate", r.caPath)
+		}
+		r.clientCAs.Store(pool)
+	}
+	r.certificate.Store(&certificate)
+	r.checksum = checksum
+	return true, nil
+}
+
+// watch polls the files until the context is cancelled
+func (r *certificateReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := r.reload()
+		if err != nil {
+			logrus.Errorf("Cannot reload TLS certificate, still serving the previous one: %v", err)
+			continue
+		}
+		if changed {
+			logrus.Infof("TLS certificate reloaded from '%s'", r.certPath)
+		}
+	}
+}
+
+// isLoaded tells if a certificate can be served
+func (r *certificateReloader) isLoaded() bool {
+	return r != nil && r.certificate.Load() != nil
+}
+
+// tlsConfig creates a server configuration, that always uses the most recently loaded certificate
+func (r *certificateReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.certificate.Load(), nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			clientCAs := r.clientCAs.Load()
+			if clientCAs == nil {
+				return nil, nil
+			}
+			return &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+					return r.certificate.Load(), nil
+				},
+				ClientCAs:  clientCAs,
+				ClientAuth: tls.RequireAndVerifyClientCert,
+			}, nil
+		},
+	}
+}
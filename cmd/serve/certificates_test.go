@@ -0,0 +1,86 @@
+package serve
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCertificate writes a self-signed certificate with given serial number and its key
+func writeSelfSignedCertificate(t *testing.T, dir string, serial int64) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "git-clone-controller"},
+		DNSNames:     []string{"git-clone-controller.default.svc"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "tls.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "tls.key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func servedSerial(t *testing.T, r *certificateReloader) int64 {
+	certificate, err := r.tlsConfig().GetCertificate(&tls.ClientHelloInfo{})
+	assert.Nil(t, err)
+	parsed, _ := x509.ParseCertificate(certificate.Certificate[0])
+	return parsed.SerialNumber.Int64()
+}
+
+func TestCertificateReloader_SwapsChangedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	writeSelfSignedCertificate(t, dir, 1)
+
+	r, err := newCertificateReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), "")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), servedSerial(t, r))
+
+	changed, _ := r.reload()
+	assert.False(t, changed, "Expected that unchanged files are not reloaded")
+
+	writeSelfSignedCertificate(t, dir, 2)
+	changed, err = r.reload()
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, int64(2), servedSerial(t, r))
+}
+
+func TestCertificateReloader_KeepsPreviousCertificateOnError(t *testing.T) {
+	dir := t.TempDir()
+	writeSelfSignedCertificate(t, dir, 1)
+	r, _ := newCertificateReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), "")
+
+	// e.g. certificate already replaced, but the key is not yet
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "tls.key"), []byte("invalid"), 0600))
+	_, err := r.reload()
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(1), servedSerial(t, r))
+}
+
+func TestCertificateReloader_RequiresClientCertificateWithCA(t *testing.T) {
+	dir := t.TempDir()
+	writeSelfSignedCertificate(t, dir, 1)
+
+	withoutCA, _ := newCertificateReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), "")
+	config, _ := withoutCA.tlsConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	assert.Nil(t, config)
+
+	withCA, err := newCertificateReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "tls.crt"))
+	assert.Nil(t, err)
+	config, _ = withCA.tlsConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+}
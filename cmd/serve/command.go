@@ -24,9 +24,29 @@ func NewServeCommand() *cobra.Command {
 	command.Flags().StringVarP(&app.LogLevel, "log-level", "l", getEnvOrDefault("LOG_LEVEL", "info").(string), "Logging level: error, warn, info, debug")
 	command.Flags().BoolVarP(&app.LogJSON, "log-json", "", getEnvOrDefault("LOG_JSON", false).(bool), "Log in JSON format")
 	command.Flags().BoolVarP(&app.TLS, "tls", "t", getEnvOrDefault("USE_TLS", false).(bool), "Use TLS (requires certificates)")
+	command.Flags().StringVarP(&app.TLSCert, "tls-cert", "", getEnvOrDefault("TLS_CERT", "/etc/admission-webhook/tls/tls.crt").(string), "Path to the TLS certificate, reloaded when changed")
+	command.Flags().StringVarP(&app.TLSKey, "tls-key", "", getEnvOrDefault("TLS_KEY", "/etc/admission-webhook/tls/tls.key").(string), "Path to the TLS private key, reloaded when changed")
+	command.Flags().StringVarP(&app.TLSCA, "tls-ca", "", getEnvOrDefault("TLS_CA", "").(string), "Path to a CA certificate, when set then clients must present a certificate signed by it (mutual TLS)")
+	command.Flags().StringVarP(&app.HTTPAddress, "http-address", "", getEnvOrDefault("HTTP_ADDRESS", ":8080").(string), "Listen address, when TLS is not used")
+	command.Flags().StringVarP(&app.HTTPSAddress, "https-address", "", getEnvOrDefault("HTTPS_ADDRESS", ":4443").(string), "Listen address, when TLS is used")
+	command.Flags().BoolVarP(&app.BootstrapCertificates, "bootstrap-certificates", "", getEnvOrDefault("BOOTSTRAP_CERTIFICATES", false).(bool), "Generate (or load) a CA from a Secret, issue the serving certificate and patch caBundle of the MutatingWebhookConfiguration. Implies TLS")
+	command.Flags().StringVarP(&app.CASecretName, "ca-secret-name", "", getEnvOrDefault("CA_SECRET_NAME", "git-clone-controller-ca").(string), "Name of the Secret keeping the CA (ca.crt, ca.key), used with --bootstrap-certificates")
+	command.Flags().StringVarP(&app.ServiceName, "service-name", "", getEnvOrDefault("SERVICE_NAME", "git-clone-controller").(string), "Name of the Service pointing to the webhook, used with --bootstrap-certificates")
+	command.Flags().StringVarP(&app.WebhookConfigurationName, "webhook-configuration-name", "", getEnvOrDefault("WEBHOOK_CONFIGURATION_NAME", "git-clone-controller").(string), "Name of the MutatingWebhookConfiguration to patch caBundle, used with --bootstrap-certificates")
+	command.Flags().StringVarP(&app.Namespace, "namespace", "", getEnvOrDefault("POD_NAMESPACE", "").(string), "Namespace the controller runs in, detected from the ServiceAccount by default")
 	command.Flags().StringVarP(&app.DefaultImage, "default-image", "i", getEnvOrDefault("DEFAULT_IMAGE", "ghcr.io/riotkit-org/git-clone-controller:master").(string), "Default container image")
-	command.Flags().StringVarP(&app.DefaultGitUsername, "default-git-username", "U", getEnvOrDefault("DEFAULT_GIT_USERNAME", "__token__").(string), "Default GIT username for HTTPS auth")
-	command.Flags().StringVarP(&app.DefaultGitToken, "default-git-token", "T", getEnvOrDefault("DEFAULT_GIT_TOKEN", "").(string), "Default GIT token/password for HTTPS auth")
+	command.Flags().StringVarP(&app.DefaultCredentialsSecret, "default-credentials-secret", "", getEnvOrDefault("DEFAULT_CREDENTIALS_SECRET", "").(string), "Name of a Secret in controller's namespace with default GIT credentials for HTTPS auth, keyed by host (e.g. github.com: 'username:token'). Used only by the controller to pin revisions of repositories on a matching host, never handed over to Pods")
+	command.Flags().BoolVarP(&app.MutateWorkloads, "mutate-workloads", "", getEnvOrDefault("MUTATE_WORKLOADS", false).(bool), "Mutate Pod templates of Deployments, StatefulSets, DaemonSets, Jobs and CronJobs (requires a webhook rule for those resources)")
+	command.Flags().BoolVarP(&app.PinRevisions, "pin-revisions", "", getEnvOrDefault("PIN_REVISIONS", false).(bool), "Resolve branches and tags to a commit at admission time, so all replicas check out the same commit (requires `get` access to secrets)")
+	command.Flags().StringVarP(&app.SecretsLabelSelector, "secrets-label-selector", "", getEnvOrDefault("SECRETS_LABEL_SELECTOR", "").(string), "Cache only secrets matching this label selector, used with --pin-revisions (e.g. riotkit.org/git-clone-controller=true)")
+	command.Flags().StringVarP(&app.SecretsNamespaces, "secrets-namespaces", "", getEnvOrDefault("SECRETS_NAMESPACES", "").(string), "Comma-separated list of namespaces to cache secrets from, used with --pin-revisions (all namespaces by default)")
+	command.Flags().StringVarP(&app.RequestTimeout, "request-timeout", "", getEnvOrDefault("REQUEST_TIMEOUT", "1800ms").(string), "Deadline for processing a single admission request, should be lower than webhook's timeoutSeconds")
+	command.Flags().BoolVarP(&app.ReportCheckouts, "report-checkouts", "", getEnvOrDefault("REPORT_CHECKOUTS", false).(bool), "Watch processed Pods and copy checked out commits from initContainers into Pod annotations. Only the replica holding the lease patches Pods (requires `watch` and `patch` access to pods, and access to leases)")
+	command.Flags().StringVarP(&app.ReportLeaseName, "report-lease-name", "", getEnvOrDefault("REPORT_LEASE_NAME", "git-clone-controller-report").(string), "Name of the Lease in controller's namespace electing a single replica to report checked out commits, used with --report-checkouts")
+	command.Flags().StringVarP(&app.PodName, "pod-name", "", getEnvOrDefault("POD_NAME", "").(string), "Identity of this replica in the leader election, hostname by default")
+	command.Flags().BoolVarP(&app.NamespaceDefaults, "namespace-defaults", "", getEnvOrDefault("NAMESPACE_DEFAULTS", false).(bool), "Take `git-clone-controller/*` annotations missing in a Pod from its Namespace (requires `list` and `watch` access to namespaces)")
+	command.Flags().BoolVarP(&app.GitRepositories, "git-repositories", "", getEnvOrDefault("GIT_REPOSITORIES", false).(bool), "Resolve `git-clone-controller/repository` annotation to a `kind: GitRepository` in Pod's namespace (requires the CRD to be installed)")
+	command.Flags().BoolVarP(&app.EnforcePermissions, "enforce-permissions", "", getEnvOrDefault("ENFORCE_PERMISSIONS", false).(bool), "Allow to clone only repositories permitted by `kind: GitClonePermissions` in Pod's namespace")
 
 	return command
 }
@@ -2,16 +2,26 @@ package serve
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/riotkit-org/git-clone-controller/pkg/admission"
+	appContext "github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/riotkit-org/git-clone-controller/pkg/crd"
+	"github.com/riotkit-org/git-clone-controller/pkg/report"
 	"github.com/sirupsen/logrus"
 	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"net/http"
 	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type Command struct {
@@ -19,32 +29,121 @@ type Command struct {
 	TLS      bool
 	LogJSON  bool
 
-	DefaultImage       string
-	DefaultGitUsername string
-	DefaultGitToken    string
+	TLSCert      string
+	TLSKey       string
+	TLSCA        string
+	HTTPAddress  string
+	HTTPSAddress string
 
-	client *kubernetes.Clientset
+	BootstrapCertificates    bool
+	CASecretName             string
+	ServiceName              string
+	WebhookConfigurationName string
+	Namespace                string
+
+	DefaultImage             string
+	DefaultCredentialsSecret string
+
+	EnforcePermissions bool
+	MutateWorkloads    bool
+	PinRevisions       bool
+	ReportCheckouts    bool
+	ReportLeaseName    string
+	PodName            string
+	NamespaceDefaults  bool
+	GitRepositories    bool
+
+	SecretsLabelSelector string
+	SecretsNamespaces    string
+	RequestTimeout       string
+
+	client         kubernetes.Interface
+	permissions    *crd.Cache
+	repositories   *crd.Cache
+	secrets        *admission.SecretCache
+	credentials    *admission.CredentialsStore
+	namespaces     *admission.NamespaceCache
+	requestTimeout time.Duration
+
+	certificates *certificateReloader
+	apiReachable atomic.Bool
+	shuttingDown atomic.Bool
 }
 
 func (c *Command) Run() error {
 	c.setLogger()
-	c.client = initClient()
-
-	// handle our core application
-	http.HandleFunc("/mutate-pods", c.ServeMutatePods)
-	http.HandleFunc("/health", c.ServeHealth)
-
-	// start the server
-	// listens to clear text http on port 8080 unless TLS env var is set to "true"
-	if c.TLS {
-		cert := "/etc/admission-webhook/tls/tls.crt"
-		key := "/etc/admission-webhook/tls/tls.key"
-		logrus.Print("Listening on port 4443...")
-		return http.ListenAndServeTLS(":4443", cert, key, nil)
-	} else {
-		logrus.Print("Listening on port 8080...")
-		return http.ListenAndServe(":8080", nil)
+	config := initConfig()
+	c.client = initClient(config)
+
+	requestTimeout, timeoutErr := time.ParseDuration(c.RequestTimeout)
+	if timeoutErr != nil {
+		return errors.Wrapf(timeoutErr, "cannot parse --request-timeout '%s'", c.RequestTimeout)
+	}
+	c.requestTimeout = requestTimeout
+
+	stop := make(chan struct{})
+	var resources []schema.GroupVersionResource
+	if c.EnforcePermissions {
+		resources = append(resources, crd.GitClonePermissionsResource)
+	}
+	if c.GitRepositories {
+		resources = append(resources, crd.GitRepositoryResource)
+	}
+	if len(resources) > 0 {
+		logrus.Info("Waiting for custom resources to be loaded")
+		resourcesCache := crd.NewCache(dynamic.NewForConfigOrDie(config), 10*time.Minute, resources...)
+		resourcesCache.Start(stop)
+		if !resourcesCache.WaitForCacheSync(stop) {
+			return errors.New("cannot load custom resources")
+		}
+		if c.EnforcePermissions {
+			c.permissions = resourcesCache
+		}
+		if c.GitRepositories {
+			c.repositories = resourcesCache
+		}
+	}
+
+	if c.PinRevisions {
+		// secrets are loaded in background, /ready tells when the webhook can start receiving requests
+		logrus.Info("Watching secrets to pin revisions")
+		if !c.MutateWorkloads {
+			logrus.Warn("Revisions are pinned when each Pod is created, replicas of one workload agree on a commit only with --mutate-workloads")
+		}
+		c.secrets = admission.NewSecretCache(c.client, 10*time.Minute, c.SecretsLabelSelector, splitList(c.SecretsNamespaces))
+		c.secrets.Start(stop)
+	}
+
+	if c.DefaultCredentialsSecret != "" {
+		namespace, namespaceErr := c.namespace()
+		if namespaceErr != nil {
+			return namespaceErr
+		}
+		logrus.Infof("Watching default credentials in secret '%s/%s'", namespace, c.DefaultCredentialsSecret)
+		c.credentials = admission.NewCredentialsStore(c.client, 10*time.Minute, namespace, c.DefaultCredentialsSecret)
+		c.credentials.Start(stop)
+	}
+
+	if c.NamespaceDefaults {
+		logrus.Info("Watching namespaces to take defaults from their annotations")
+		c.namespaces = admission.NewNamespaceCache(c.client, 10*time.Minute)
+		c.namespaces.Start(stop)
 	}
+
+	if c.ReportCheckouts {
+		namespace, namespaceErr := c.namespace()
+		if namespaceErr != nil {
+			return namespaceErr
+		}
+		identity, identityErr := c.identity()
+		if identityErr != nil {
+			return identityErr
+		}
+		logrus.Infof("Reporting checked out commits, when holding the lease '%s/%s' as '%s'", namespace, c.ReportLeaseName, identity)
+		report.NewLeaderElection(c.client, 10*time.Minute, namespace, c.ReportLeaseName, identity).Start(stop)
+	}
+
+	return c.serve(stop)
 }
 
 // ServeHealth returns 200 when things are good
@@ -53,6 +152,17 @@ func (c *Command) ServeHealth(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "OK")
 }
 
+// ServeReady returns 200 when the webhook can process requests: certificates are loaded, Kubernetes API is reachable,
+// caches are synced and the server is not shutting down
+func (c *Command) ServeReady(w http.ResponseWriter, r *http.Request) {
+	if reason := c.notReadyReason(); reason != "" {
+		logrus.WithField("uri", r.RequestURI).Debugf("not ready: %s", reason)
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprint(w, "OK")
+}
+
 // ServeMutatePods returns an admission review with pod mutations as a json patch
 // in the review response
 func (c *Command) ServeMutatePods(w http.ResponseWriter, r *http.Request) {
@@ -66,16 +176,25 @@ func (c *Command) ServeMutatePods(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx, cancel := context.WithTimeout(r.Context(), c.requestTimeout)
+	defer cancel()
+
 	adm := admission.MutationRequest{
+		Context:      ctx,
 		Logger:       logger,
 		IsDebugLevel: c.LogLevel == "debug",
 		Request:      in.Request,
 
 		DefaultImage:       c.DefaultImage,
-		DefaultGitUsername: c.DefaultGitUsername,
-		DefaultGitToken:    c.DefaultGitToken,
+		DefaultCredentials: c.defaultCredentials(),
 
-		Client: c.client,
+		Client:          c.client,
+		Permissions:     c.permissions,
+		Repositories:    c.repositories,
+		MutateWorkloads: c.MutateWorkloads,
+		PinRevisions:    c.PinRevisions,
+		Secrets:         c.secrets,
+		Namespaces:      c.namespaces,
 	}
 
 	out, err := adm.ProcessAdmissionRequest()
@@ -100,6 +219,14 @@ func (c *Command) ServeMutatePods(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "%s", jout)
 }
 
+// defaultCredentials returns operator-wide credentials keyed by host, empty when not configured
+func (c *Command) defaultCredentials() appContext.DefaultCredentials {
+	if c.credentials == nil {
+		return appContext.DefaultCredentials{}
+	}
+	return c.credentials.Get()
+}
+
 // setLogger sets the logger using env vars, it defaults to text logs on
 // debug level unless otherwise specified
 func (c *Command) setLogger() {
@@ -143,7 +270,7 @@ func (c *Command) parseRequest(r http.Request) (*admissionv1.AdmissionReview, er
 	return &a, nil
 }
 
-func initClient() *kubernetes.Clientset {
+func initConfig() *rest.Config {
 	kubeConfig := os.Getenv("HOME") + "/.kube/config"
 	if os.Getenv("KUBECONFIG") != "" {
 		kubeConfig = os.Getenv("KUBECONFIG")
@@ -156,10 +283,24 @@ func initClient() *kubernetes.Clientset {
 	if err != nil {
 		panic(err.Error())
 	}
+	return config
+}
 
+func initClient(config *rest.Config) *kubernetes.Clientset {
 	clientSet, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		panic(err.Error())
 	}
 	return clientSet
 }
+
+// splitList splits a comma-separated list, skipping empty elements
+func splitList(value string) []string {
+	var elements []string
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
@@ -0,0 +1,203 @@
+package serve
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/riotkit-org/git-clone-controller/pkg/certificates"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// readinessPropagationDelay is how long the server keeps accepting requests after readiness started failing,
+	// so the Pod can be removed from Service endpoints before connections are closed
+	readinessPropagationDelay = 5 * time.Second
+
+	// shutdownTimeout limits waiting for in-flight admission requests to finish
+	shutdownTimeout = 15 * time.Second
+
+	// apiCheckInterval is how often the Kubernetes API reachability is checked for readiness
+	apiCheckInterval = 10 * time.Second
+
+	// caBundleCheckInterval is how often the bootstrapped certificate and `caBundle` of the webhook are checked
+	caBundleCheckInterval = time.Minute
+
+	// serviceAccountNamespacePath contains the namespace the controller runs in
+	serviceAccountNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+	// certificateReloadInterval is how often TLS files are checked for changes
+	certificateReloadInterval = 30 * time.Second
+)
+
+// serve starts the HTTP(S) server and blocks until SIGTERM/SIGINT. On shutdown readiness fails first, then connections are drained
+func (c *Command) serve(stop chan struct{}) error {
+	defer close(stop)
+
+	server := &http.Server{
+		Handler:           c.createRouter(),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      c.requestTimeout + 5*time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	// listens to clear text http unless TLS env var is set to "true"
+	if c.BootstrapCertificates {
+		bootstrapper, err := c.createBootstrapper()
+		if err != nil {
+			return err
+		}
+		certificate, bootstrapErr := bootstrapper.Bootstrap(ctx)
+		if bootstrapErr != nil {
+			return errors.Wrap(bootstrapErr, "cannot bootstrap TLS certificate")
+		}
+		c.certificates = newStaticCertificate(certificate)
+		go bootstrapper.Watch(ctx, certificate, caBundleCheckInterval, c.certificates.store)
+		server.Addr = c.HTTPSAddress
+		server.TLSConfig = c.certificates.tlsConfig()
+	} else if c.TLS {
+		certificates, err := newCertificateReloader(c.TLSCert, c.TLSKey, c.TLSCA)
+		if err != nil {
+			return errors.Wrap(err, "cannot load TLS certificate")
+		}
+		c.certificates = certificates
+		go certificates.watch(ctx, certificateReloadInterval)
+		server.Addr = c.HTTPSAddress
+		server.TLSConfig = certificates.tlsConfig()
+	} else {
+		server.Addr = c.HTTPAddress
+	}
+
+	go c.watchAPI(ctx)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logrus.Printf("Listening on %s...", server.Addr)
+		if server.TLSConfig != nil {
+			serveErr <- server.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	logrus.Infof("Shutting down, failing readiness for %v before draining connections", readinessPropagationDelay)
+	c.shuttingDown.Store(true)
+	time.Sleep(readinessPropagationDelay)
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return errors.Wrap(err, "cannot gracefully shut down the server")
+	}
+	logrus.Info("Server stopped")
+	return nil
+}
+
+// namespace returns the namespace the controller runs in, detected from the ServiceAccount when not specified
+func (c *Command) namespace() (string, error) {
+	if c.Namespace != "" {
+		return c.Namespace, nil
+	}
+	detected, err := os.ReadFile(serviceAccountNamespacePath)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot detect the namespace, use --namespace")
+	}
+	return strings.TrimSpace(string(detected)), nil
+}
+
+// identity tells which replica is running, in the leader election
+func (c *Command) identity() (string, error) {
+	if c.PodName != "" {
+		return c.PodName, nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot detect the Pod name, use --pod-name")
+	}
+	return hostname, nil
+}
+
+// createBootstrapper configures self-signed certificates
+func (c *Command) createBootstrapper() (*certificates.Bootstrapper, error) {
+	namespace, err := c.namespace()
+	if err != nil {
+		return nil, err
+	}
+	return &certificates.Bootstrapper{
+		Client:                   c.client,
+		Namespace:                namespace,
+		SecretName:               c.CASecretName,
+		ServiceName:              c.ServiceName,
+		WebhookConfigurationName: c.WebhookConfigurationName,
+	}, nil
+}
+
+// createRouter registers endpoints of our core application
+func (c *Command) createRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mutate-pods", c.ServeMutatePods)
+	if c.MutateWorkloads {
+		mux.HandleFunc("/mutate-workloads", c.ServeMutatePods)
+	}
+	mux.HandleFunc("/health", c.ServeHealth)
+	mux.HandleFunc("/ready", c.ServeReady)
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
+
+// watchAPI periodically checks if Kubernetes API is reachable. Checked in background, so a hanging API does not block probes
+func (c *Command) watchAPI(ctx context.Context) {
+	ticker := time.NewTicker(apiCheckInterval)
+	defer ticker.Stop()
+	for {
+		_, err := c.client.Discovery().ServerVersion()
+		if err != nil {
+			logrus.Warnf("Kubernetes API is not reachable: %v", err)
+		}
+		c.apiReachable.Store(err == nil)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// notReadyReason tells why the webhook cannot process requests, empty when ready
+func (c *Command) notReadyReason() string {
+	if c.shuttingDown.Load() {
+		return "shutting down"
+	}
+	if (c.TLS || c.BootstrapCertificates) && !c.certificates.isLoaded() {
+		return "TLS certificate is not loaded"
+	}
+	if !c.apiReachable.Load() {
+		return "Kubernetes API is not reachable"
+	}
+	if c.secrets != nil && !c.secrets.HasSynced() {
+		return "secrets are not loaded yet"
+	}
+	if c.credentials != nil && !c.credentials.HasSynced() {
+		return "default credentials are not loaded yet"
+	}
+	if c.namespaces != nil && !c.namespaces.HasSynced() {
+		return "namespaces are not loaded yet"
+	}
+	return ""
+}
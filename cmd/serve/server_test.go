@@ -0,0 +1,46 @@
+package serve
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func ready(c *Command) (int, string) {
+	w := httptest.NewRecorder()
+	c.ServeReady(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	return w.Code, w.Body.String()
+}
+
+func TestServeReady(t *testing.T) {
+	c := &Command{TLS: true, client: fake.NewSimpleClientset()}
+
+	code, body := ready(c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "TLS certificate is not loaded")
+
+	c.certificates = &certificateReloader{}
+	c.certificates.certificate.Store(&tls.Certificate{})
+	code, body = ready(c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "Kubernetes API is not reachable")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.watchAPI(ctx)
+	assert.Eventually(t, func() bool {
+		code, _ = ready(c)
+		return code == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	// readiness fails first on shutdown, so no new requests are routed to the Pod
+	c.shuttingDown.Store(true)
+	code, body = ready(c)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "shutting down")
+}
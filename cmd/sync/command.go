@@ -0,0 +1,48 @@
+package sync
+
+import (
+	"github.com/riotkit-org/git-clone-controller/cmd/checkout"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+func NewSyncCommand() *cobra.Command {
+	app := &Command{}
+
+	command := &cobra.Command{
+		Use:   "sync",
+		Short: "Keeps a GIT checkout updated by periodically fetching the repository and atomically publishing new revisions",
+		Run: func(command *cobra.Command, args []string) {
+			if app.Probe {
+				if err := app.RunProbe(); err != nil {
+					logrus.Errorf(err.Error())
+					os.Exit(1)
+				}
+				return
+			}
+
+			if len(args) == 0 {
+				logrus.Errorf("Please enter a GIT url as an argument")
+				os.Exit(1)
+			}
+
+			app.Checkout.Url = args[0]
+			err := app.Run()
+
+			if err != nil {
+				logrus.Errorf(err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+
+	checkout.BindFlags(command, &app.Checkout)
+	command.Flags().DurationVarP(&app.Interval, "interval", "i", time.Minute, "How often to check the remote repository for changes")
+	command.Flags().StringVarP(&app.StoragePath, "storage-path", "", "", "Directory where the repository and published revisions are kept, must be on same volume as --path (defaults to: .{path basename}.git-sync next to --path)")
+	command.Flags().BoolVarP(&app.Probe, "probe", "", false, "Only check if any revision was already published at --path, useful as a startupProbe")
+	app.Checkout.IsBare = false
+
+	return command
+}
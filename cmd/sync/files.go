@@ -0,0 +1,73 @@
+package sync
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// copyWorktree copies files of a GIT worktree (without `.git` directory) into a new directory.
+// The copy is first created under a temporary name, so an interrupted copy is never published
+func copyWorktree(source string, target string) error {
+	temporary := target + ".tmp"
+	if err := os.RemoveAll(temporary); err != nil {
+		return err
+	}
+
+	err := filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, _ := filepath.Rel(source, path)
+		// also `.git` files of submodules
+		if entry.Name() == ".git" {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		destination := filepath.Join(temporary, relative)
+
+		info, infoErr := entry.Info()
+		if infoErr != nil {
+			return infoErr
+		}
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(destination, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, linkErr := os.Readlink(path)
+			if linkErr != nil {
+				return linkErr
+			}
+			return os.Symlink(link, destination)
+		default:
+			return copyFile(path, destination, info.Mode().Perm())
+		}
+	})
+	if err != nil {
+		_ = os.RemoveAll(temporary)
+		return err
+	}
+	return os.Rename(temporary, target)
+}
+
+func copyFile(source string, destination string, mode os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,197 @@
+package sync
+
+import (
+	"context"
+	"github.com/moby/sys/mountinfo"
+	"github.com/pkg/errors"
+	"github.com/riotkit-org/git-clone-controller/cmd/checkout"
+	"github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"syscall"
+	"time"
+)
+
+var commitRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Command periodically updates a private clone of the repository, then publishes each new commit as a copy of the worktree.
+// The target path is a symbolic link swapped atomically with rename(2), so readers never see a partially updated tree
+type Command struct {
+	Checkout    checkout.Command
+	Interval    time.Duration
+	StoragePath string
+	Probe       bool
+
+	previous string
+}
+
+func (c *Command) Run() error {
+	if err := c.prepare(); err != nil {
+		return errors.Wrap(err, "Validation failed")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	logrus.Infof("Synchronizing '%s' into '%s' every %v", c.Checkout.Url, c.publishPath(), c.Interval)
+	for {
+		if err := c.synchronize(); err != nil {
+			logrus.Errorf("Synchronization failed, will retry in %v: %s", c.Interval, err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			logrus.Info("Stopping synchronization")
+			return nil
+		case <-time.After(c.Interval):
+		}
+	}
+}
+
+// RunProbe checks if any revision was already published: the path must be a symbolic link to an existing snapshot.
+// A plain directory e.g. created by a volume is not a published revision
+func (c *Command) RunProbe() error {
+	target, err := filepath.Abs(c.Checkout.Path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Lstat(target)
+	if err != nil {
+		return errors.Wrapf(err, "No revision published yet at '%s'", target)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return errors.Errorf("No revision published yet, '%s' is not a symbolic link managed by sync", target)
+	}
+	snapshot, err := os.Readlink(target)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(snapshot) {
+		snapshot = filepath.Join(filepath.Dir(target), snapshot)
+	}
+	storage, err := filepath.Abs(c.storagePath(target))
+	if err != nil {
+		return err
+	}
+	if filepath.Dir(snapshot) != storage || !commitRegexp.MatchString(filepath.Base(snapshot)) {
+		return errors.Errorf("'%s' points to '%s', which is not a snapshot in '%s'", target, snapshot, storage)
+	}
+	if _, err := os.Stat(snapshot); err != nil {
+		return errors.Wrapf(err, "Published snapshot '%s' does not exist", snapshot)
+	}
+	return nil
+}
+
+// storagePath returns the directory keeping the private clone and snapshots, by default next to the published path
+func (c *Command) storagePath(target string) string {
+	if c.StoragePath != "" {
+		return c.StoragePath
+	}
+	return filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".git-sync")
+}
+
+// prepare validates paths and restores the published commit. Published path is replaced with a symbolic link, so it cannot be a volume mount point itself
+func (c *Command) prepare() error {
+	// the sidecar runs as long as the Pod, it must not need root to hand the files over
+	if c.Checkout.Chown != "" {
+		return errors.New("--chown is supported only by the checkout command")
+	}
+	target, err := filepath.Abs(c.Checkout.Path)
+	if err != nil {
+		return err
+	}
+	c.Checkout.Path = target
+
+	if mounted, _ := mountinfo.Mounted(target); mounted {
+		return errors.Errorf("'%s' is a mount point, in sync mode the path must be a subdirectory of a shared volume e.g. '%s/repository'", target, target)
+	}
+	c.StoragePath = c.storagePath(target)
+	if err := os.MkdirAll(c.StoragePath, 0755); err != nil {
+		return errors.Wrap(err, "Cannot create storage directory")
+	}
+	// after a restart the currently published snapshot could still be read by the application
+	if published, err := os.Readlink(target); err == nil && commitRegexp.MatchString(filepath.Base(published)) {
+		c.previous = filepath.Base(published)
+	}
+	return nil
+}
+
+// synchronize updates the private clone, then publishes its HEAD if it has changed
+func (c *Command) synchronize() error {
+	repository := c.Checkout
+	repository.Path = filepath.Join(c.StoragePath, "repository")
+
+	head, err := repository.Checkout()
+	if err != nil {
+		return err
+	}
+	commit := head.Hash().String()
+
+	if current, _ := os.Readlink(c.publishPath()); filepath.Base(current) == commit {
+		logrus.Debugf("Already published commit '%s'", commit)
+		return nil
+	}
+
+	snapshot := filepath.Join(c.StoragePath, commit)
+	if _, statErr := os.Stat(snapshot); errors.Is(statErr, os.ErrNotExist) {
+		if err := copyWorktree(repository.Path, snapshot); err != nil {
+			return errors.Wrapf(err, "Cannot copy commit '%s' into '%s'", commit, snapshot)
+		}
+	}
+	if err := c.publish(snapshot); err != nil {
+		return errors.Wrapf(err, "Cannot publish commit '%s'", commit)
+	}
+	logrus.Infof("Published '%s', at commit '%s'", head.Name().String(), commit)
+
+	c.cleanUp(commit)
+	c.previous = commit
+	return nil
+}
+
+// publish atomically points the published path to the snapshot using a relative symbolic link
+func (c *Command) publish(snapshot string) error {
+	target := c.publishPath()
+
+	// first run: an empty directory could be created e.g. by a volume
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		if err := os.Remove(target); err != nil {
+			return errors.Wrapf(err, "'%s' already exists and is not a symbolic link managed by sync", target)
+		}
+	}
+
+	relative, err := filepath.Rel(filepath.Dir(target), snapshot)
+	if err != nil {
+		return err
+	}
+	temporary := target + ".tmp-link"
+	_ = os.Remove(temporary)
+	if err := os.Symlink(relative, temporary); err != nil {
+		return err
+	}
+	return os.Rename(temporary, target)
+}
+
+// cleanUp removes old snapshots. The previous one is kept, as it could still be read by the application
+func (c *Command) cleanUp(current string) {
+	entries, err := os.ReadDir(c.StoragePath)
+	if err != nil {
+		logrus.Warningf("Cannot list '%s': %s", c.StoragePath, err.Error())
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == current || name == c.previous || !commitRegexp.MatchString(name) {
+			continue
+		}
+		logrus.Debugf("Removing old snapshot '%s'", name)
+		if err := os.RemoveAll(filepath.Join(c.StoragePath, name)); err != nil {
+			logrus.Warningf("Cannot remove old snapshot '%s': %s", name, err.Error())
+		}
+	}
+}
+
+func (c *Command) publishPath() string {
+	return c.Checkout.Path
+}
@@ -0,0 +1,116 @@
+package sync
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/riotkit-org/git-clone-controller/cmd/checkout"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// commitFile creates a commit in a local "remote" repository
+func commitFile(t *testing.T, repository *git.Repository, dir string, name string, content string) string {
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	w, _ := repository.Worktree()
+	_, _ = w.Add(name)
+	hash, err := w.Commit("Update "+name, &git.CommitOptions{Author: &object.Signature{Name: "Kropotkin", Email: "peter@example.org", When: time.Now()}})
+	assert.Nil(t, err)
+	return hash.String()
+}
+
+func TestCommand_Synchronize(t *testing.T) {
+	remoteDir := t.TempDir()
+	remote, _ := git.PlainInit(remoteDir, false)
+	first := commitFile(t, remote, remoteDir, "index.html", "first")
+
+	volume := t.TempDir()
+	c := Command{
+		Checkout: checkout.Command{
+			Path:             filepath.Join(volume, "theme"),
+			Url:              remoteDir,
+			Revision:         "master",
+			CleanUpRemotes:   true,
+			CleanUpWorkspace: true,
+		},
+		Interval: time.Second,
+	}
+	assert.Nil(t, c.prepare())
+
+	// Step 1: initial publish
+	assert.Nil(t, c.synchronize())
+	link, _ := os.Readlink(filepath.Join(volume, "theme"))
+	assert.Equal(t, filepath.Join(".theme.git-sync", first), link, "Expected a relative symbolic link")
+	content, _ := os.ReadFile(filepath.Join(volume, "theme", "index.html"))
+	assert.Equal(t, "first", string(content))
+	assert.NoDirExists(t, filepath.Join(volume, "theme", ".git"), "GIT metadata should not be published")
+	assert.Nil(t, c.RunProbe())
+
+	// Step 2: new commit is published, previous snapshot is kept
+	second := commitFile(t, remote, remoteDir, "index.html", "second")
+	assert.Nil(t, c.synchronize())
+	content, _ = os.ReadFile(filepath.Join(volume, "theme", "index.html"))
+	assert.Equal(t, "second", string(content))
+	assert.DirExists(t, filepath.Join(volume, ".theme.git-sync", first))
+
+	// Step 3: older snapshots are removed
+	commitFile(t, remote, remoteDir, "index.html", "third")
+	assert.Nil(t, c.synchronize())
+	assert.NoDirExists(t, filepath.Join(volume, ".theme.git-sync", first))
+	assert.DirExists(t, filepath.Join(volume, ".theme.git-sync", second))
+}
+
+func TestCommand_RunProbe_NothingPublished(t *testing.T) {
+	c := Command{Checkout: checkout.Command{Path: filepath.Join(t.TempDir(), "theme")}}
+	assert.NotNil(t, c.RunProbe())
+}
+
+func TestCommand_RunProbe_PlainDirectoryIsNotPublished(t *testing.T) {
+	volume := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(volume, "theme"), 0755))
+
+	c := Command{Checkout: checkout.Command{Path: filepath.Join(volume, "theme")}}
+	assert.ErrorContains(t, c.RunProbe(), "is not a symbolic link managed by sync")
+}
+
+func TestCommand_RunProbe_LinkOutsideOfSnapshots(t *testing.T) {
+	volume := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(volume, "elsewhere"), 0755))
+	assert.Nil(t, os.Symlink("elsewhere", filepath.Join(volume, "theme")))
+
+	c := Command{Checkout: checkout.Command{Path: filepath.Join(volume, "theme")}}
+	assert.ErrorContains(t, c.RunProbe(), "which is not a snapshot in")
+}
+
+func TestCommand_Synchronize_KeepsPublishedSnapshotAfterRestart(t *testing.T) {
+	remoteDir := t.TempDir()
+	remote, _ := git.PlainInit(remoteDir, false)
+	first := commitFile(t, remote, remoteDir, "index.html", "first")
+
+	volume := t.TempDir()
+	newCommand := func() *Command {
+		c := &Command{
+			Checkout: checkout.Command{
+				Path:             filepath.Join(volume, "theme"),
+				Url:              remoteDir,
+				Revision:         "master",
+				CleanUpRemotes:   true,
+				CleanUpWorkspace: true,
+			},
+			Interval: time.Second,
+		}
+		assert.Nil(t, c.prepare())
+		return c
+	}
+	assert.Nil(t, newCommand().synchronize())
+
+	// the container was restarted, meanwhile a new commit was pushed
+	second := commitFile(t, remote, remoteDir, "index.html", "second")
+	assert.Nil(t, newCommand().synchronize())
+
+	link, _ := os.Readlink(filepath.Join(volume, "theme"))
+	assert.Equal(t, filepath.Join(".theme.git-sync", second), link)
+	assert.DirExists(t, filepath.Join(volume, ".theme.git-sync", first), "Expected that the snapshot published before the restart is kept, as it could still be read")
+}
@@ -4,16 +4,18 @@
 package admission
 
 import (
-	"context"
+	goCtx "context"
 	"encoding/json"
 	"fmt"
 	"github.com/pkg/errors"
 	appContext "github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/riotkit-org/git-clone-controller/pkg/crd"
 	"github.com/wI2L/jsondiff"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"net/http"
+	"time"
 
 	"github.com/riotkit-org/git-clone-controller/pkg/mutation"
 	"github.com/sirupsen/logrus"
@@ -27,50 +29,197 @@ type MutationRequest struct {
 	IsDebugLevel bool
 	Request      *admissionv1.AdmissionRequest
 
-	DefaultImage       string
-	DefaultGitUsername string
-	DefaultGitToken    string
+	DefaultImage string
+
+	// DefaultCredentials are used by the controller only, to pin revisions of repositories on a matching host
+	// when the Pod does not reference a `kind: Secret`. Those are never handed over to Pods
+	DefaultCredentials appContext.DefaultCredentials
 
 	Client kubernetes.Interface
+
+	// MutateWorkloads when set, then Pod templates of workloads (Deployment, StatefulSet, DaemonSet, Job, CronJob) are mutated
+	MutateWorkloads bool
+
+	// PinRevisions when set, then branches and tags are resolved to a commit at admission time using Client to read secrets
+	PinRevisions bool
+
+	// Secrets when set, then `kind: Secret` is read from the cache instead of the API
+	Secrets *SecretCache
+
+	// Context is cancelled, when the webhook request times out
+	Context goCtx.Context
+
+	// Namespaces when set, then `git-clone-controller/*` annotations of the Pod's Namespace are defaults for the Pod
+	Namespaces *NamespaceCache
+
+	// Permissions when set, then each Pod must be allowed by a GitClonePermissions in its namespace
+	Permissions *crd.Cache
+
+	// Repositories when set, then `git-clone-controller/repository` annotation is resolved to a GitRepository in Pod's namespace
+	Repositories *crd.Cache
+}
+
+// requestContext returns the request-scoped context, API calls and `git ls-remote` must finish before the webhook times out
+func (a MutationRequest) requestContext() goCtx.Context {
+	if a.Context == nil {
+		return goCtx.Background()
+	}
+	return a.Context
+}
+
+// admissionResult is an admission review with a reason of the decision, the reason is used as a metrics label
+type admissionResult struct {
+	review *admissionv1.AdmissionReview
+	reason string
+	err    error
 }
 
 // ProcessAdmissionRequest takes an admission request and mutates the pod within,
 // it returns an admission review with mutations as a json patch (if any)
 func (a MutationRequest) ProcessAdmissionRequest() (*admissionv1.AdmissionReview, error) {
+	started := time.Now()
+	var result admissionResult
+	if a.MutateWorkloads && isWorkload(a.Request.Kind.Kind) {
+		result = a.processWorkloadAdmissionRequest()
+	} else {
+		result = a.processPodAdmissionRequest()
+	}
+	observeAdmission(a.Request.Kind.Kind, result, time.Since(started))
+	return result.review, result.err
+}
+
+// processPodAdmissionRequest mutates a Pod
+func (a MutationRequest) processPodAdmissionRequest() admissionResult {
 	pod, err := ResolvePod(a)
 	if err != nil {
 		e := fmt.Sprintf("could not parse pod in admission review request: %v", err)
-		return reviewResponse(a.Request.UID, false, http.StatusBadRequest, e), err
+		return admissionResult{reviewResponse(a.Request.UID, false, http.StatusBadRequest, e), ReasonInvalidObject, err}
 	}
 
 	// validate
 	if !isPodToBeProcessed(pod) {
-		return reviewResponse(a.Request.UID, true, http.StatusOK, ""), nil
+		return admissionResult{reviewResponse(a.Request.UID, true, http.StatusOK, ""), ReasonNotLabelled, nil}
 	}
-	gitUserName, gitToken, secretErr := resolveSecretForPod(context.TODO(), a.Client, pod)
-	if secretErr != nil {
-		return reviewResponse(a.Request.UID, false, http.StatusBadRequest, errors.Wrap(secretErr, "git-clone-controller: Missing `kind: Secret` for annotated Pod").Error()), err
+	// nothing is resolved (remote revisions, permissions, secrets) for Pods created from an already mutated template
+	if isAlreadyInjected(pod) {
+		return admissionResult{reviewResponse(a.Request.UID, true, http.StatusOK, ""), ReasonUnchanged, nil}
 	}
-
-	// glue parameters together
-	parameters, paramsErr := appContext.NewCheckoutParametersFromPod(pod, a.DefaultImage, a.DefaultGitUsername, a.DefaultGitToken, gitUserName, gitToken)
-	if paramsErr != nil {
-		return reviewResponse(a.Request.UID, false, http.StatusBadRequest, errors.Wrap(paramsErr, "git-clone-controller: Cannot parse Pod labels/annotations").Error()), paramsErr
+	parametersList, denial := a.resolveParameters(pod, nil)
+	if denial != nil {
+		return *denial
 	}
 
 	// create a patch
-	patch, err := a.CreatePodPatch(pod, parameters)
+	patch, err := a.CreatePodPatch(pod, parametersList...)
 	if err != nil {
-		e := fmt.Sprintf("could not mutate pod: %v", err)
-		return reviewResponse(a.Request.UID, false, http.StatusBadRequest, e), err
+		return mutationErrorResponse(a.Request.UID, err, ReasonMutationFailed)
 	}
 
-	return patchReviewResponse(a.Request.UID, patch)
+	review, err := patchReviewResponse(a.Request.UID, patch)
+	return admissionResult{review, ReasonMutated, err}
+}
+
+// isAlreadyInjected tells if the Pod has containers of all checkout specifications described in its annotations
+func isAlreadyInjected(pod *corev1.Pod) bool {
+	specs, err := appContext.FindCheckoutSpecs(pod.Annotations)
+	if err != nil {
+		return false
+	}
+	if len(specs) == 0 {
+		specs = []string{""}
+	}
+	for _, spec := range specs {
+		if !mutation.IsInjected(pod, spec) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveParameters builds parameters of each checkout specification described in Pod annotations.
+// Previous version of the Pod (template) is given on workload update, to keep its pinned commits.
+// Returns an admission result, when the Pod should be denied
+func (a MutationRequest) resolveParameters(pod *corev1.Pod, previous *corev1.Pod) ([]appContext.Parameters, *admissionResult) {
+	// a Pod can have multiple repositories described with indexed annotations
+	specs, specsErr := appContext.FindCheckoutSpecs(pod.Annotations)
+	if specsErr != nil {
+		return nil, &admissionResult{reviewResponse(a.Request.UID, false, http.StatusBadRequest, errors.Wrap(specsErr, "git-clone-controller: Cannot parse Pod labels/annotations").Error()), ReasonInvalidAnnotations, specsErr}
+	}
+	if len(specs) == 0 {
+		specs = []string{""}
+	}
+
+	var namespaceAnnotations map[string]string
+	if a.Namespaces != nil {
+		namespaceAnnotations = a.Namespaces.Annotations(pod.Namespace)
+	}
+
+	var parametersList []appContext.Parameters
+	for _, spec := range specs {
+		repositoryAnnotations, repositoryErr := a.resolveRepository(pod, spec)
+		if repositoryErr != nil {
+			return nil, &admissionResult{reviewResponse(a.Request.UID, false, http.StatusBadRequest, errors.Wrap(repositoryErr, "git-clone-controller").Error()), ReasonInvalidAnnotations, nil}
+		}
+		inherited := appContext.InheritedAnnotations{Repository: repositoryAnnotations, Namespace: namespaceAnnotations}
+		secret := resolveSecretForPod(pod, spec, inherited)
+
+		// glue parameters together: Pod annotations > GitRepository > Namespace annotations > operator defaults
+		parameters, paramsErr := appContext.NewCheckoutParametersForSpec(pod, spec, inherited, a.DefaultImage, a.DefaultCredentials, secret)
+		if paramsErr != nil {
+			return nil, &admissionResult{reviewResponse(a.Request.UID, false, http.StatusBadRequest, errors.Wrap(paramsErr, "git-clone-controller: Cannot parse Pod labels/annotations").Error()), ReasonInvalidAnnotations, paramsErr}
+		}
+
+		// GitClonePermissions
+		if a.Permissions != nil {
+			permission, permissionErr := a.Permissions.AuthorizeRepository(pod.Namespace, parameters.GitUrl, parameters.GitRevision)
+			if permissionErr != nil {
+				return nil, &admissionResult{reviewResponse(a.Request.UID, false, http.StatusForbidden, errors.Wrap(permissionErr, "git-clone-controller").Error()), ReasonNotPermitted, nil}
+			}
+			if !secret.IsDefined() {
+				parameters = parameters.WithSecret(permission.Spec.SecretRef.ToParameters())
+			}
+		}
+
+		// all replicas should check out the same commit, even if somebody pushes during a rollout
+		if a.PinRevisions && parameters.Mode != appContext.ModeSync {
+			commit := previouslyPinned(previous, pod, spec)
+			if commit == "" {
+				resolved, resolveErr := a.resolveCommit(pod.Namespace, parameters)
+				if resolveErr != nil {
+					result := mutationErrorResponse(a.Request.UID, resolveErr, ReasonRevisionNotResolved)
+					return nil, &result
+				}
+				if resolved != "" {
+					logrus.Infof("Revision '%s' of '%s' pinned to commit '%s'", parameters.GitRevision, parameters.GitUrl, resolved)
+				}
+				commit = resolved
+			}
+			parameters.ResolvedCommit = commit
+		}
+
+		parametersList = append(parametersList, parameters)
+	}
+	return parametersList, nil
+}
+
+// previouslyPinned returns the commit pinned in the previous version of a workload, when its repository and revision were not changed.
+// An unrelated update of the workload then does not move it to a newer commit, which would start a rollout
+func previouslyPinned(previous *corev1.Pod, pod *corev1.Pod, spec string) string {
+	if previous == nil {
+		return ""
+	}
+	annotations := appContext.ForSpec(pod.Annotations, spec)
+	for _, key := range []string{appContext.AnnotationGitUrl, appContext.AnnotationRev, appContext.AnnotationRepository} {
+		if previous.Annotations[annotations.Name(key)] != pod.Annotations[annotations.Name(key)] {
+			return ""
+		}
+	}
+	return previous.Annotations[annotations.Name(appContext.AnnotationResolvedCommit)]
 }
 
 // CreatePodPatch returns a json patch containing all the mutations needed for
 // a given pod
-func (a MutationRequest) CreatePodPatch(pod *corev1.Pod, params appContext.Parameters) ([]byte, error) {
+func (a MutationRequest) CreatePodPatch(pod *corev1.Pod, params ...appContext.Parameters) ([]byte, error) {
 	var podName string
 	if pod.ObjectMeta.Name != "" {
 		podName = pod.ObjectMeta.Name
@@ -81,13 +230,17 @@ func (a MutationRequest) CreatePodPatch(pod *corev1.Pod, params appContext.Param
 	}
 	log := logrus.WithField("pod_name", podName)
 
-	mutatedPod, mutateErr := mutation.MutatePodByInjectingInitContainer(pod.DeepCopy(), log, params)
+	mutatedPod, mutateErr := mutation.MutatePodByInjectingInitContainer(pod.DeepCopy(), log, params...)
 	if mutateErr != nil {
 		return nil, errors.Wrap(mutateErr, "Cannot mutate pod")
 	}
 
-	// generate json patch
-	patch, err := jsondiff.Compare(pod, mutatedPod)
+	return createPatch(pod, mutatedPod)
+}
+
+// createPatch generates a json patch between the original and the mutated object
+func createPatch(original interface{}, mutated interface{}) ([]byte, error) {
+	patch, err := jsondiff.Compare(original, mutated)
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +253,16 @@ func (a MutationRequest) CreatePodPatch(pod *corev1.Pod, params appContext.Param
 	return patchBytes, nil
 }
 
+// mutationErrorResponse denies the admission with a clear reason, when the mutation was rejected. Other errors are unexpected
+func mutationErrorResponse(uid types.UID, err error, reason string) admissionResult {
+	var rejection mutation.RejectionError
+	if errors.As(err, &rejection) {
+		return admissionResult{reviewResponse(uid, false, http.StatusForbidden, "git-clone-controller: "+rejection.Reason), reason, nil}
+	}
+	e := fmt.Sprintf("could not mutate pod: %v", err)
+	return admissionResult{reviewResponse(uid, false, http.StatusBadRequest, e), reason, err}
+}
+
 // reviewResponse sends a review response without returning a patch
 func reviewResponse(uid types.UID, allowed bool, httpCode int32, reason string) *admissionv1.AdmissionReview {
 	return &admissionv1.AdmissionReview{
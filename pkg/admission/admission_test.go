@@ -1,13 +1,20 @@
 package admission
 
 import (
+	"context"
 	"net/http"
 	"testing"
 
+	"github.com/riotkit-org/git-clone-controller/pkg/crd"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	admissionv1 "k8s.io/api/admission/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
 )
 
 func TestReviewResponse(t *testing.T) {
@@ -57,3 +64,157 @@ func TestPatchReviewResponse(t *testing.T) {
 	}
 	assert.Equal(t, want, got)
 }
+
+func TestProcessAdmissionRequest_DeniedByGitClonePermissions(t *testing.T) {
+	client := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		crd.GitClonePermissionsResource: "GitClonePermissionsList",
+	})
+	_, _ = client.Resource(crd.GitClonePermissionsResource).Namespace("anarchism").Create(context.TODO(), &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "riotkit.org/v1alpha1",
+		"kind":       "GitClonePermissions",
+		"metadata":   map[string]interface{}{"name": "themes", "namespace": "anarchism"},
+		"spec": map[string]interface{}{
+			"allowedUrls": []interface{}{"https://git.example.org/themes/*"},
+			"secretRef":   map[string]interface{}{"name": "themes-token", "tokenKey": "token"},
+		},
+	}}, metav1.CreateOptions{})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	permissions := crd.NewCache(client, 0, crd.GitClonePermissionsResource)
+	permissions.Start(stop)
+	permissions.WaitForCacheSync(stop)
+
+	process := func(url string) *admissionv1.AdmissionReview {
+		raw := `{"kind":"Pod","apiVersion":"v1","metadata":{"name":"test","namespace":"anarchism",` +
+			`"labels":{"riotkit.org/git-clone-controller":"true"},` +
+			`"annotations":{"git-clone-controller/url":"` + url + `","git-clone-controller/path":"/workspace/source","git-clone-controller/owner":"1000","git-clone-controller/group":"1000"}},` +
+			`"spec":{"containers":[{"name":"app","image":"busybox","volumeMounts":[{"name":"workspace","mountPath":"/workspace"}]}]}}`
+
+		request := MutationRequest{
+			Logger:       logrus.NewEntry(logrus.New()),
+			Request:      &admissionv1.AdmissionRequest{UID: "test", Namespace: "anarchism", Object: runtime.RawExtension{Raw: []byte(raw)}},
+			DefaultImage: "ghcr.io/riotkit-org/git-clone-controller",
+			Permissions:  permissions,
+		}
+		request.Request.Kind.Kind = "Pod"
+
+		review, err := request.ProcessAdmissionRequest()
+		assert.Nil(t, err)
+		return review
+	}
+
+	denied := process("https://github.com/riotkit-org/git-clone-controller")
+	assert.False(t, denied.Response.Allowed)
+	assert.Equal(t, int32(http.StatusForbidden), denied.Response.Result.Code)
+	assert.Contains(t, denied.Response.Result.Message, "is not allowed in namespace 'anarchism'")
+
+	allowed := process("https://git.example.org/themes/iwa")
+	assert.True(t, allowed.Response.Allowed)
+	assert.Contains(t, string(allowed.Response.Patch), "themes-token", "Expected that credentials from GitClonePermissions will be used")
+}
+
+func TestProcessAdmissionRequest_DeniedWhenPathIsNotOnVolume(t *testing.T) {
+	raw := `{"kind":"Pod","apiVersion":"v1","metadata":{"name":"test","namespace":"anarchism",` +
+		`"labels":{"riotkit.org/git-clone-controller":"true"},` +
+		`"annotations":{"git-clone-controller/url":"https://git.example.org/themes/iwa","git-clone-controller/path":"/var/www/html","git-clone-controller/owner":"1000","git-clone-controller/group":"1000"}},` +
+		`"spec":{"containers":[{"name":"app","image":"busybox","volumeMounts":[{"name":"workspace","mountPath":"/workspace"}]}]}}`
+
+	request := MutationRequest{
+		Logger:       logrus.NewEntry(logrus.New()),
+		Request:      &admissionv1.AdmissionRequest{UID: "test", Namespace: "anarchism", Object: runtime.RawExtension{Raw: []byte(raw)}},
+		DefaultImage: "ghcr.io/riotkit-org/git-clone-controller",
+	}
+	request.Request.Kind.Kind = "Pod"
+
+	review, err := request.ProcessAdmissionRequest()
+	assert.Nil(t, err)
+	assert.False(t, review.Response.Allowed)
+	assert.Equal(t, int32(http.StatusForbidden), review.Response.Result.Code)
+	assert.Contains(t, review.Response.Result.Message, "no container mounts a volume containing path '/var/www/html'")
+}
+
+func TestProcessAdmissionRequest_ResolvesGitRepository(t *testing.T) {
+	client := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		crd.GitRepositoryResource: "GitRepositoryList",
+	})
+	_, _ = client.Resource(crd.GitRepositoryResource).Namespace("anarchism").Create(context.TODO(), &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "riotkit.org/v1alpha1",
+		"kind":       "GitRepository",
+		"metadata":   map[string]interface{}{"name": "my-theme", "namespace": "anarchism"},
+		"spec": map[string]interface{}{
+			"url":       "https://git.example.org/themes/iwa",
+			"revision":  "v1.0",
+			"secretRef": map[string]interface{}{"name": "themes-token", "tokenKey": "token"},
+		},
+	}}, metav1.CreateOptions{})
+
+	stop := make(chan struct{})
+	defer close(stop)
+	repositories := crd.NewCache(client, 0, crd.GitRepositoryResource)
+	repositories.Start(stop)
+	repositories.WaitForCacheSync(stop)
+
+	process := func(repository string, cache *crd.Cache) *admissionv1.AdmissionReview {
+		raw := `{"kind":"Pod","apiVersion":"v1","metadata":{"name":"test","namespace":"anarchism",` +
+			`"labels":{"riotkit.org/git-clone-controller":"true"},` +
+			`"annotations":{"git-clone-controller/repository":"` + repository + `","git-clone-controller/revision":"v2.0","git-clone-controller/path":"/workspace/source","git-clone-controller/owner":"1000","git-clone-controller/group":"1000"}},` +
+			`"spec":{"containers":[{"name":"app","image":"busybox","volumeMounts":[{"name":"workspace","mountPath":"/workspace"}]}]}}`
+
+		request := MutationRequest{
+			Logger:       logrus.NewEntry(logrus.New()),
+			Request:      &admissionv1.AdmissionRequest{UID: "test", Namespace: "anarchism", Object: runtime.RawExtension{Raw: []byte(raw)}},
+			DefaultImage: "ghcr.io/riotkit-org/git-clone-controller",
+			Repositories: cache,
+		}
+		request.Request.Kind.Kind = "Pod"
+
+		review, err := request.ProcessAdmissionRequest()
+		assert.Nil(t, err)
+		return review
+	}
+
+	resolved := process("my-theme", repositories)
+	assert.True(t, resolved.Response.Allowed)
+	assert.Contains(t, string(resolved.Response.Patch), "https://git.example.org/themes/iwa")
+	assert.Contains(t, string(resolved.Response.Patch), "themes-token", "Expected that credentials from GitRepository will be used")
+	assert.Contains(t, string(resolved.Response.Patch), "v2.0", "Expected that Pod annotation overrides revision of GitRepository")
+
+	missing := process("other-theme", repositories)
+	assert.False(t, missing.Response.Allowed)
+	assert.Contains(t, missing.Response.Result.Message, "GitRepository 'other-theme' not found in namespace 'anarchism'")
+
+	disabled := process("my-theme", nil)
+	assert.False(t, disabled.Response.Allowed)
+	assert.Contains(t, disabled.Response.Result.Message, "GitRepository resources are not enabled")
+}
+
+func TestProcessAdmissionRequest_AlreadyInjectedPodIsNotResolved(t *testing.T) {
+	client := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		crd.GitClonePermissionsResource: "GitClonePermissionsList",
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	permissions := crd.NewCache(client, 0, crd.GitClonePermissionsResource)
+	permissions.Start(stop)
+	permissions.WaitForCacheSync(stop)
+
+	raw := `{"kind":"Pod","apiVersion":"v1","metadata":{"name":"test","namespace":"anarchism",` +
+		`"labels":{"riotkit.org/git-clone-controller":"true"},` +
+		`"annotations":{"git-clone-controller/url":"https://git.example.org/themes/iwa","git-clone-controller/path":"/workspace/source","git-clone-controller/owner":"1000","git-clone-controller/group":"1000"}},` +
+		`"spec":{"initContainers":[{"name":"git-checkout","image":"ghcr.io/riotkit-org/git-clone-controller"}],` +
+		`"containers":[{"name":"app","image":"busybox","volumeMounts":[{"name":"workspace","mountPath":"/workspace"}]}]}}`
+
+	request := MutationRequest{
+		Logger:       logrus.NewEntry(logrus.New()),
+		Request:      &admissionv1.AdmissionRequest{UID: "test", Namespace: "anarchism", Object: runtime.RawExtension{Raw: []byte(raw)}},
+		DefaultImage: "ghcr.io/riotkit-org/git-clone-controller",
+		Permissions:  permissions,
+	}
+	request.Request.Kind.Kind = "Pod"
+
+	review, err := request.ProcessAdmissionRequest()
+	assert.Nil(t, err)
+	assert.True(t, review.Response.Allowed, "Expected that GitClonePermissions are not checked again for an already mutated Pod")
+	assert.Nil(t, review.Response.Patch)
+}
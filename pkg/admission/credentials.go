@@ -0,0 +1,64 @@
+package admission
+
+import (
+	appContext "github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"time"
+)
+
+// CredentialsStore watches a single `kind: Secret` with operator-wide GIT credentials keyed by host
+type CredentialsStore struct {
+	factory   informers.SharedInformerFactory
+	lister    corelisters.SecretLister
+	synced    cache.InformerSynced
+	namespace string
+	name      string
+}
+
+// NewCredentialsStore creates a store watching `kind: Secret` of given name
+func NewCredentialsStore(client kubernetes.Interface, resync time.Duration, namespace string, name string) *CredentialsStore {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, resync,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
+	secrets := factory.Core().V1().Secrets()
+	return &CredentialsStore{
+		factory:   factory,
+		lister:    secrets.Lister(),
+		synced:    secrets.Informer().HasSynced,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// Start begins watching the secret in background
+func (s *CredentialsStore) Start(stopCh <-chan struct{}) {
+	s.factory.Start(stopCh)
+}
+
+// HasSynced tells if the secret was initially loaded
+func (s *CredentialsStore) HasSynced() bool {
+	return s.synced()
+}
+
+// Get returns current credentials. A missing secret means no operator-wide credentials at all
+func (s *CredentialsStore) Get() appContext.DefaultCredentials {
+	secret, err := s.lister.Secrets(s.namespace).Get(s.name)
+	if apierrors.IsNotFound(err) {
+		return appContext.DefaultCredentials{}
+	}
+	if err != nil {
+		logrus.Errorf("Cannot read default credentials from secret '%s/%s': %v", s.namespace, s.name, err)
+		return appContext.DefaultCredentials{}
+	}
+	return appContext.ParseDefaultCredentials(secret.Data)
+}
@@ -0,0 +1,68 @@
+package admission
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appContext "github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCredentialsStore_Get(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "git-credentials", Namespace: "git-clone-controller"},
+		Data:       map[string][]byte{"github.com": []byte("bakunin:solidarity")},
+	})
+	store := NewCredentialsStore(client, time.Minute, "git-clone-controller", "git-credentials")
+	stop := make(chan struct{})
+	defer close(stop)
+	store.Start(stop)
+	assert.True(t, cache.WaitForCacheSync(stop, store.HasSynced))
+
+	assert.Equal(t, appContext.DefaultCredentials{"github.com": {Username: "bakunin", Token: "solidarity"}}, store.Get())
+}
+
+func TestCredentialsStore_MissingSecret(t *testing.T) {
+	store := NewCredentialsStore(fake.NewSimpleClientset(), time.Minute, "git-clone-controller", "git-credentials")
+	stop := make(chan struct{})
+	defer close(stop)
+	store.Start(stop)
+	assert.True(t, cache.WaitForCacheSync(stop, store.HasSynced))
+
+	assert.Empty(t, store.Get())
+}
+
+func TestProcessAdmissionRequest_DefaultCredentialsAreNotHandedOverToPod(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	raw := `{"kind":"Pod","apiVersion":"v1","metadata":{"name":"test","namespace":"anarchism",` +
+		`"labels":{"riotkit.org/git-clone-controller":"true"},` +
+		`"annotations":{"git-clone-controller/url":"https://git.example.org:8443/themes/iwa","git-clone-controller/path":"/workspace/source","git-clone-controller/owner":"1000","git-clone-controller/group":"1000"}},` +
+		`"spec":{"containers":[{"name":"app","image":"busybox","volumeMounts":[{"name":"workspace","mountPath":"/workspace"}]}]}}`
+
+	request := MutationRequest{
+		Logger:             logrus.NewEntry(logrus.New()),
+		Request:            &admissionv1.AdmissionRequest{UID: "test", Namespace: "anarchism", Object: runtime.RawExtension{Raw: []byte(raw)}},
+		DefaultImage:       "ghcr.io/riotkit-org/git-clone-controller",
+		DefaultCredentials: appContext.DefaultCredentials{"git.example.org:8443": {Username: "bakunin", Token: "solidarity"}},
+		Client:             client,
+	}
+	request.Request.Kind.Kind = "Pod"
+
+	review, err := request.ProcessAdmissionRequest()
+	assert.Nil(t, err)
+	assert.True(t, review.Response.Allowed)
+	assert.NotContains(t, string(review.Response.Patch), "solidarity")
+	assert.NotContains(t, string(review.Response.Patch), "GIT_TOKEN")
+
+	secrets, listErr := client.CoreV1().Secrets("anarchism").List(context.TODO(), metav1.ListOptions{})
+	assert.Nil(t, listErr)
+	assert.Empty(t, secrets.Items, "Expected that operator-wide credentials are not copied into the Pod's namespace")
+}
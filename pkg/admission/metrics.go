@@ -0,0 +1,63 @@
+package admission
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+const (
+	ResultAllowed = "allowed"
+	ResultDenied  = "denied"
+	ResultSkipped = "skipped"
+)
+
+// reasons of admission decisions, used as metrics labels
+const (
+	ReasonMutated             = "mutated"
+	ReasonNotLabelled         = "not_labelled"
+	ReasonUnchanged           = "unchanged"
+	ReasonInvalidObject       = "invalid_object"
+	ReasonInvalidAnnotations  = "invalid_annotations"
+	ReasonNotPermitted        = "not_permitted"
+	ReasonRevisionNotResolved = "revision_not_resolved"
+	ReasonMutationFailed      = "mutation_failed"
+)
+
+var (
+	admissionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "git_clone_controller",
+		Name:      "admissions_total",
+		Help:      "Number of processed admission requests by result (allowed, denied, skipped) and reason",
+	}, []string{"result", "reason"})
+
+	admissionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "git_clone_controller",
+		Name:      "admission_duration_seconds",
+		Help:      "Time of processing admission requests, the webhook is called with a timeout of a few seconds",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 1.5, 2, 5, 10},
+	}, []string{"kind"})
+
+	secretResolutionErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "git_clone_controller",
+		Name:      "secret_resolution_errors_total",
+		Help:      "Number of failures to read GIT credentials from `kind: Secret` by namespace",
+	}, []string{"namespace"})
+)
+
+// observeAdmission records result and duration of an admission request
+func observeAdmission(kind string, result admissionResult, duration time.Duration) {
+	admissionsTotal.WithLabelValues(admissionResultLabel(result), result.reason).Inc()
+	admissionDuration.WithLabelValues(kind).Observe(duration.Seconds())
+}
+
+// admissionResultLabel tells if the object was mutated, denied, or passed without changes
+func admissionResultLabel(result admissionResult) string {
+	if result.err != nil || result.review == nil || !result.review.Response.Allowed {
+		return ResultDenied
+	}
+	if result.review.Response.Patch == nil {
+		return ResultSkipped
+	}
+	return ResultAllowed
+}
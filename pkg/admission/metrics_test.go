@@ -0,0 +1,51 @@
+package admission
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestProcessAdmissionRequest_RecordsMetrics(t *testing.T) {
+	process := func(raw string, pin bool) {
+		request := MutationRequest{
+			Logger:       logrus.NewEntry(logrus.New()),
+			Request:      &admissionv1.AdmissionRequest{UID: "test", Namespace: "metrics", Object: runtime.RawExtension{Raw: []byte(raw)}},
+			DefaultImage: "ghcr.io/riotkit-org/git-clone-controller",
+			Client:       fake.NewSimpleClientset(),
+			PinRevisions: pin,
+		}
+		request.Request.Kind.Kind = "Pod"
+		_, _ = request.ProcessAdmissionRequest()
+	}
+	pod := func(annotations string) string {
+		return `{"kind":"Pod","apiVersion":"v1","metadata":{"name":"test","namespace":"metrics",` +
+			`"labels":{"riotkit.org/git-clone-controller":"true"},"annotations":{` + annotations + `}},` +
+			`"spec":{"containers":[{"name":"app","image":"busybox","volumeMounts":[{"name":"workspace","mountPath":"/workspace"}]}]}}`
+	}
+	valid := `"git-clone-controller/url":"https://git.example.org/themes/iwa","git-clone-controller/path":"/workspace/source","git-clone-controller/owner":"1000","git-clone-controller/group":"1000"`
+
+	skipped := testutil.ToFloat64(admissionsTotal.WithLabelValues(ResultSkipped, ReasonNotLabelled))
+	process(`{"kind":"Pod","apiVersion":"v1","metadata":{"name":"test"}}`, false)
+	assert.Equal(t, skipped+1, testutil.ToFloat64(admissionsTotal.WithLabelValues(ResultSkipped, ReasonNotLabelled)))
+
+	allowed := testutil.ToFloat64(admissionsTotal.WithLabelValues(ResultAllowed, ReasonMutated))
+	process(pod(valid), false)
+	assert.Equal(t, allowed+1, testutil.ToFloat64(admissionsTotal.WithLabelValues(ResultAllowed, ReasonMutated)))
+
+	invalid := testutil.ToFloat64(admissionsTotal.WithLabelValues(ResultDenied, ReasonInvalidAnnotations))
+	process(pod(`"git-clone-controller/url":"https://git.example.org/themes/iwa"`), false)
+	assert.Equal(t, invalid+1, testutil.ToFloat64(admissionsTotal.WithLabelValues(ResultDenied, ReasonInvalidAnnotations)))
+
+	// `kind: Secret` does not exist
+	process(pod(valid+`,"git-clone-controller/secretName":"missing","git-clone-controller/secretTokenKey":"token"`), true)
+	assert.Equal(t, float64(1), testutil.ToFloat64(secretResolutionErrorsTotal.WithLabelValues("metrics")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(admissionsTotal.WithLabelValues(ResultDenied, ReasonRevisionNotResolved)))
+
+	assert.Greater(t, testutil.CollectAndCount(admissionDuration), 0)
+}
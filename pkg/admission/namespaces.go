@@ -0,0 +1,60 @@
+package admission
+
+import (
+	appContext "github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"strings"
+	"time"
+)
+
+// NamespaceCache keeps `kind: Namespace` in memory, annotations of a Namespace are defaults for all its Pods
+type NamespaceCache struct {
+	factory informers.SharedInformerFactory
+	lister  corelisters.NamespaceLister
+	synced  cache.InformerSynced
+}
+
+// NewNamespaceCache creates a cache of all namespaces
+func NewNamespaceCache(client kubernetes.Interface, resync time.Duration) *NamespaceCache {
+	factory := informers.NewSharedInformerFactory(client, resync)
+	namespaces := factory.Core().V1().Namespaces()
+	return &NamespaceCache{
+		factory: factory,
+		lister:  namespaces.Lister(),
+		synced:  namespaces.Informer().HasSynced,
+	}
+}
+
+// Start begins watching namespaces in background
+func (c *NamespaceCache) Start(stopCh <-chan struct{}) {
+	c.factory.Start(stopCh)
+}
+
+// HasSynced tells if all namespaces were initially loaded
+func (c *NamespaceCache) HasSynced() bool {
+	return c.synced()
+}
+
+// Annotations returns `git-clone-controller/*` annotations of given namespace, together with OpenShift ranges of user and group ids
+func (c *NamespaceCache) Annotations(name string) map[string]string {
+	namespace, err := c.lister.Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		logrus.Errorf("Cannot read namespace '%s': %v", name, err)
+		return nil
+	}
+	annotations := map[string]string{}
+	for key, value := range namespace.Annotations {
+		if strings.HasPrefix(key, "git-clone-controller/") || key == appContext.AnnotationOpenShiftUIDRange || key == appContext.AnnotationOpenShiftSupplementalGroups {
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
@@ -0,0 +1,73 @@
+package admission
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func createNamespaceCache(t *testing.T) *NamespaceCache {
+	client := fake.NewSimpleClientset(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "anarchism", Annotations: map[string]string{
+			"git-clone-controller/owner":          "161",
+			"git-clone-controller/group":          "161",
+			"git-clone-controller/secretName":     "git-iwa",
+			"git-clone-controller/secretTokenKey": "gitToken",
+			"openshift.io/sa.scc.uid-range":       "1000650000/10000",
+			"kubernetes.io/description":           "not related",
+		}},
+	})
+	namespaces := NewNamespaceCache(client, time.Minute)
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	namespaces.Start(stop)
+	assert.True(t, cache.WaitForCacheSync(stop, namespaces.HasSynced))
+	return namespaces
+}
+
+func TestNamespaceCache_Annotations(t *testing.T) {
+	namespaces := createNamespaceCache(t)
+
+	assert.Equal(t, map[string]string{
+		"git-clone-controller/owner":          "161",
+		"git-clone-controller/group":          "161",
+		"git-clone-controller/secretName":     "git-iwa",
+		"git-clone-controller/secretTokenKey": "gitToken",
+		"openshift.io/sa.scc.uid-range":       "1000650000/10000",
+	}, namespaces.Annotations("anarchism"))
+	assert.Nil(t, namespaces.Annotations("syndicalism"))
+}
+
+func TestProcessAdmissionRequest_TakesDefaultsFromNamespace(t *testing.T) {
+	// owner, group and the secret are not repeated in the Pod, the Pod overrides the group
+	raw := `{"kind":"Pod","apiVersion":"v1","metadata":{"name":"test","namespace":"anarchism",` +
+		`"labels":{"riotkit.org/git-clone-controller":"true"},` +
+		`"annotations":{"git-clone-controller/url":"https://git.example.org/themes/iwa","git-clone-controller/path":"/workspace/source","git-clone-controller/group":"1000"}},` +
+		`"spec":{"containers":[{"name":"app","image":"busybox","volumeMounts":[{"name":"workspace","mountPath":"/workspace"}]}]}}`
+
+	request := MutationRequest{
+		Logger:       logrus.NewEntry(logrus.New()),
+		Request:      &admissionv1.AdmissionRequest{UID: "test", Namespace: "anarchism", Object: runtime.RawExtension{Raw: []byte(raw)}},
+		DefaultImage: "ghcr.io/riotkit-org/git-clone-controller",
+		Namespaces:   createNamespaceCache(t),
+	}
+	request.Request.Kind.Kind = "Pod"
+
+	review, err := request.ProcessAdmissionRequest()
+	assert.Nil(t, err)
+	assert.True(t, review.Response.Allowed)
+
+	patch := string(review.Response.Patch)
+	assert.Contains(t, patch, `"runAsUser":161`)
+	assert.Contains(t, patch, `"runAsGroup":1000`, "Expected that Pod annotation takes precedence over Namespace annotation")
+	assert.Contains(t, patch, `"name":"git-iwa"`)
+	assert.Contains(t, patch, `"key":"gitToken"`)
+}
@@ -1,52 +1,60 @@
 package admission
 
 import (
-	goCtx "context"
 	"github.com/pkg/errors"
 	"github.com/riotkit-org/git-clone-controller/pkg/context"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 )
 
-// resolveSecretForPod Finds a `kind: Secret` using information from ResolvePod's annotations and extracts secrets from that secret by specified keys
-func resolveSecretForPod(ctx goCtx.Context, client kubernetes.Interface, pod *corev1.Pod) (string, string, error) {
+// resolveSecretForPod Builds a reference to `kind: Secret` using information from ResolvePod's annotations (of given checkout specification).
+// The secret itself is not fetched. Annotations missing in the Pod are taken from the referenced GitRepository, then from the Pod's Namespace
+func resolveSecretForPod(pod *corev1.Pod, spec string, inherited context.InheritedAnnotations) context.SecretReference {
+	annotations := context.ForSpec(pod.Annotations, spec).WithInherited(inherited)
+
 	// checking required annotations
-	if val, exists := pod.Annotations[context.AnnotationSecretName]; !exists || val == "" {
-		logrus.Infof("No annotation '%s' defined for Pod '%s/%s', skipping secret", context.AnnotationSecretName, pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
-		return "", "", nil
+	if annotations.Get(context.AnnotationSecretName) == "" {
+		logrus.Infof("No annotation '%s' defined for Pod '%s/%s', skipping secret", annotations.Name(context.AnnotationSecretName), pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
+		return context.SecretReference{}
 	}
-	if val, exists := pod.Annotations[context.AnnotationSecretTokenKey]; !exists || val == "" {
-		logrus.Infof("No annotation '%s' defined for Pod '%s/%s'", context.AnnotationSecretTokenKey, pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
-		return "", "", nil
+	// either token (HTTPS) or private key (SSH) must be there
+	if annotations.Get(context.AnnotationSecretTokenKey) == "" && annotations.Get(context.AnnotationSSHKeySecretKey) == "" {
+		logrus.Infof("No annotation '%s' or '%s' defined for Pod '%s/%s'", annotations.Name(context.AnnotationSecretTokenKey), annotations.Name(context.AnnotationSSHKeySecretKey), pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
+		return context.SecretReference{}
 	}
 
 	// username is not mandatory
-	if val, exists := pod.Annotations[context.AnnotationSecretUserKey]; !exists || val == "" {
-		logrus.Debugf("No annotation '%s' defined for Pod '%s/%s'", context.AnnotationSecretUserKey, pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
+	if annotations.Get(context.AnnotationSecretUserKey) == "" {
+		logrus.Debugf("No annotation '%s' defined for Pod '%s/%s'", annotations.Name(context.AnnotationSecretUserKey), pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
 	}
 
-	// fetching `kind: Secret` from API
-	secretName := pod.Annotations[context.AnnotationSecretName]
-	secret, err := client.CoreV1().Secrets(pod.ObjectMeta.Namespace).Get(ctx, secretName, metav1.GetOptions{})
-	if err != nil {
-		return "", "", errors.Wrapf(err, "Cannot fetch secret for Pod annotated with '%s=%s', secret name: '%s', namespace: '%s'", context.AnnotationSecretName, pod.Annotations[context.AnnotationSecretName], secretName, pod.ObjectMeta.Namespace)
+	return context.SecretReference{
+		Name:        annotations.Get(context.AnnotationSecretName),
+		TokenKey:    annotations.Get(context.AnnotationSecretTokenKey),
+		UsernameKey: annotations.Get(context.AnnotationSecretUserKey),
+
+		SSHKeyKey:     annotations.Get(context.AnnotationSSHKeySecretKey),
+		KnownHostsKey: annotations.Get(context.AnnotationKnownHostsSecretKey),
+
+		SSHKeyPassphraseKey: annotations.Get(context.AnnotationSSHKeyPassphraseSecretKey),
 	}
+}
 
-	// extracting data from `kind: Secret`
-	token, tokenDefined := secret.Data[pod.Annotations[context.AnnotationSecretTokenKey]]
-	if !tokenDefined {
-		return "", "", errors.Errorf("The secret '%s' does not contain key '%s'", secretName, pod.Annotations[context.AnnotationSecretTokenKey])
+// resolveRepository returns settings of a `kind: GitRepository` referenced by given checkout specification, as annotations.
+// Returns nothing, when the specification does not reference any GitRepository
+func (a MutationRequest) resolveRepository(pod *corev1.Pod, spec string) (map[string]string, error) {
+	annotations := context.ForSpec(pod.Annotations, spec)
+	name := annotations.Get(context.AnnotationRepository)
+	if name == "" {
+		return nil, nil
 	}
-	var username []byte
-	if _, exists := pod.Annotations[context.AnnotationSecretUserKey]; exists {
-		var usernameDefined bool
-		username, usernameDefined = secret.Data[pod.Annotations[context.AnnotationSecretUserKey]]
-		if !usernameDefined {
-			return "", "", errors.Errorf("The secret '%s' does not contain key '%s', while the annotation on Pod specifies that key", secretName, pod.Annotations[context.AnnotationSecretUserKey])
-		}
+	if a.Repositories == nil {
+		return nil, errors.Errorf("annotation '%s' cannot be used, GitRepository resources are not enabled in git-clone-controller", annotations.Name(context.AnnotationRepository))
 	}
-
-	return string(username), string(token), nil
+	repository, err := a.Repositories.GetRepository(pod.Namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Debugf("Checkout specification '%s' of Pod '%s/%s' uses GitRepository '%s'", spec, pod.Namespace, pod.Name, name)
+	return repository.Spec.ToAnnotations(), nil
 }
@@ -1,25 +1,13 @@
 package admission
 
 import (
-	"context"
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes/fake"
 	"testing"
 )
 
 func TestResolvingWithAllValidFields(t *testing.T) {
-	client := fake.NewSimpleClientset(&corev1.Secret{
-		TypeMeta:   metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
-		ObjectMeta: metav1.ObjectMeta{Name: "my-secret-name", Namespace: "default"},
-		Data: map[string][]byte{
-			"username": []byte("hello"),
-			"password": []byte("riotkit"),
-		},
-		Type: "opaque",
-	})
-
 	pod := corev1.Pod{}
 	pod.Namespace = "default"
 	pod.Annotations = map[string]string{
@@ -33,95 +21,74 @@ func TestResolvingWithAllValidFields(t *testing.T) {
 	pod.Annotations["git-clone-controller/path"] = "/var/www/riotkit"
 	pod.Annotations["git-clone-controller/url"] = "https://github.com/riotkit-org/git-clone-controller"
 
-	returnedUsername, returnedPassword, err := resolveSecretForPod(context.TODO(), client, &pod)
+	ref := resolveSecretForPod(&pod, "", context.InheritedAnnotations{})
 
-	assert.Nil(t, err)
-	assert.Equal(t, "hello", returnedUsername)
-	assert.Equal(t, "riotkit", returnedPassword)
+	assert.Equal(t, context.SecretReference{Name: "my-secret-name", TokenKey: "password", UsernameKey: "username"}, ref)
+	assert.True(t, ref.IsDefined())
 }
 
-func TestResolvingWithMissingPasswordInKindSecret(t *testing.T) {
-	client := fake.NewSimpleClientset(&corev1.Secret{
-		TypeMeta:   metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
-		ObjectMeta: metav1.ObjectMeta{Name: "my-secret-name", Namespace: "default"},
-		Data: map[string][]byte{
-			"username": []byte("hello"),
-			// "password": []byte("riotkit"),  // this one is MISSING
-		},
-		Type: "opaque",
-	})
-
+func TestResolvingWithMissingTokenKeyAnnotation(t *testing.T) {
 	pod := corev1.Pod{}
 	pod.Namespace = "default"
 	pod.Annotations = map[string]string{
 		"git-clone-controller/secretName": "my-secret-name",
 	}
-	pod.Annotations["git-clone-controller/secretTokenKey"] = "password"
+	// "git-clone-controller/secretTokenKey" is MISSING
 	pod.Annotations["git-clone-controller/secretUsernameKey"] = "username"
-	pod.Annotations["git-clone-controller/revision"] = "HEAD"
-	pod.Annotations["git-clone-controller/group"] = "161"
-	pod.Annotations["git-clone-controller/owner"] = "161"
-	pod.Annotations["git-clone-controller/path"] = "/var/www/riotkit"
 	pod.Annotations["git-clone-controller/url"] = "https://github.com/riotkit-org/git-clone-controller"
 
-	_, _, err := resolveSecretForPod(context.TODO(), client, &pod)
+	ref := resolveSecretForPod(&pod, "", context.InheritedAnnotations{})
 
-	assert.Equal(t, "The secret 'my-secret-name' does not contain key 'password'", err.Error())
+	assert.False(t, ref.IsDefined())
 }
 
-func TestResolvingWithMissingUsernameInKindSecret(t *testing.T) {
-	client := fake.NewSimpleClientset(&corev1.Secret{
-		TypeMeta:   metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
-		ObjectMeta: metav1.ObjectMeta{Name: "my-secret-name", Namespace: "default"},
-		Data: map[string][]byte{
-			// "username": []byte("hello"),  // this one was defined in annotations, but missing in `kind: Secret`
-			"password": []byte("riotkit"),
-		},
-		Type: "opaque",
-	})
-
+func TestResolvingWithUsernameIsNotMandatory(t *testing.T) {
 	pod := corev1.Pod{}
 	pod.Namespace = "default"
 	pod.Annotations = map[string]string{
 		"git-clone-controller/secretName": "my-secret-name",
 	}
 	pod.Annotations["git-clone-controller/secretTokenKey"] = "password"
-	pod.Annotations["git-clone-controller/secretUsernameKey"] = "username" // here we make the "username" field in `kind: Secret` mandatory
 	pod.Annotations["git-clone-controller/revision"] = "HEAD"
 	pod.Annotations["git-clone-controller/group"] = "161"
 	pod.Annotations["git-clone-controller/owner"] = "161"
 	pod.Annotations["git-clone-controller/path"] = "/var/www/riotkit"
 	pod.Annotations["git-clone-controller/url"] = "https://github.com/riotkit-org/git-clone-controller"
 
-	_, _, err := resolveSecretForPod(context.TODO(), client, &pod)
+	ref := resolveSecretForPod(&pod, "", context.InheritedAnnotations{})
 
-	assert.Equal(t, "The secret 'my-secret-name' does not contain key 'username', while the annotation on Pod specifies that key", err.Error())
+	assert.True(t, ref.IsDefined())
+	assert.Equal(t, "", ref.UsernameKey)
 }
 
-func TestResolvingWithUsernameIsNotMandatory(t *testing.T) {
-	client := fake.NewSimpleClientset(&corev1.Secret{
-		TypeMeta:   metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
-		ObjectMeta: metav1.ObjectMeta{Name: "my-secret-name", Namespace: "default"},
-		Data: map[string][]byte{
-			// "username": []byte("hello"),  // this one is not mandatory, when `git-clone-controller/secretUsernameKey` annotation was not defined
-			"password": []byte("riotkit"),
-		},
-		Type: "opaque",
-	})
-
+func TestResolvingWithSSHKeyOnly(t *testing.T) {
 	pod := corev1.Pod{}
 	pod.Namespace = "default"
 	pod.Annotations = map[string]string{
-		"git-clone-controller/secretName": "my-secret-name",
+		"git-clone-controller/secretName":          "my-secret-name",
+		"git-clone-controller/sshKeySecretKey":     "id_ed25519",
+		"git-clone-controller/knownHostsSecretKey": "known_hosts",
+		"git-clone-controller/url":                 "git@github.com:riotkit-org/git-clone-controller.git",
+	}
+
+	ref := resolveSecretForPod(&pod, "", context.InheritedAnnotations{})
+
+	assert.True(t, ref.IsDefined())
+	assert.Equal(t, context.SecretReference{Name: "my-secret-name", SSHKeyKey: "id_ed25519", KnownHostsKey: "known_hosts"}, ref)
+}
+
+func TestResolvingWithNamespaceDefaults(t *testing.T) {
+	pod := corev1.Pod{}
+	pod.Namespace = "anarchism"
+	pod.Annotations = map[string]string{
+		"git-clone-controller/secretTokenKey": "podToken",
+		"git-clone-controller/url":            "https://github.com/riotkit-org/git-clone-controller",
 	}
-	pod.Annotations["git-clone-controller/secretTokenKey"] = "password"
-	pod.Annotations["git-clone-controller/revision"] = "HEAD"
-	pod.Annotations["git-clone-controller/group"] = "161"
-	pod.Annotations["git-clone-controller/owner"] = "161"
-	pod.Annotations["git-clone-controller/path"] = "/var/www/riotkit"
-	pod.Annotations["git-clone-controller/url"] = "https://github.com/riotkit-org/git-clone-controller"
 
-	_, _, err := resolveSecretForPod(context.TODO(), client, &pod)
+	ref := resolveSecretForPod(&pod, "", context.InheritedAnnotations{Namespace: map[string]string{
+		"git-clone-controller/secretName":     "git-iwa",
+		"git-clone-controller/secretTokenKey": "namespaceToken",
+	}})
 
-	assert.Nil(t, err)
+	assert.Equal(t, context.SecretReference{Name: "git-iwa", TokenKey: "podToken"}, ref)
 }
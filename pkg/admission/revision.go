@@ -0,0 +1,221 @@
+package admission
+
+import (
+	goCtx "context"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/pkg/errors"
+	appContext "github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/riotkit-org/git-clone-controller/pkg/mutation"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"os"
+	"strings"
+	"time"
+)
+
+// pinRevisionTimeout limits listing of remote references, when the request has a longer (or no) deadline
+const pinRevisionTimeout = 5 * time.Second
+
+// remoteCredentials are GIT credentials read from the Pod's `kind: Secret` or taken from operator defaults
+type remoteCredentials struct {
+	username   string
+	token      string
+	sshKey     []byte
+	knownHosts []byte
+	passphrase []byte
+}
+
+// resolveCommit lists references of the remote repository (`git ls-remote`) using the Pod's credentials and returns the commit
+// the revision points to. Annotated tags are peeled to the tagged commit. Empty result means the revision could not be pinned
+func (a MutationRequest) resolveCommit(namespace string, params appContext.Parameters) (string, error) {
+	if plumbing.IsHash(params.GitRevision) {
+		return "", nil
+	}
+
+	ctx, cancel := goCtx.WithTimeout(a.requestContext(), pinRevisionTimeout)
+	defer cancel()
+
+	credentials, credentialsErr := a.readCredentials(ctx, namespace, params)
+	if credentialsErr != nil {
+		secretResolutionErrorsTotal.WithLabelValues(namespace).Inc()
+		return "", credentialsErr
+	}
+	auth, authErr := createAuthMethod(params.GitUrl, credentials)
+	if authErr != nil {
+		return "", authErr
+	}
+	if auth == nil && isSSHUrl(params.GitUrl) {
+		logrus.Warnf("Not pinning revision of '%s', SSH host key cannot be verified without known_hosts", params.GitUrl)
+		return "", nil
+	}
+
+	endpoint, endpointErr := transport.NewEndpoint(params.GitUrl)
+	if endpointErr != nil {
+		return "", mutation.RejectionError{Reason: fmt.Sprintf("cannot parse GIT url '%s': %v", params.GitUrl, endpointErr)}
+	}
+	gitClient, clientErr := client.NewClient(endpoint)
+	if clientErr != nil {
+		return "", mutation.RejectionError{Reason: fmt.Sprintf("unsupported GIT url '%s': %v", params.GitUrl, clientErr)}
+	}
+	session, sessionErr := gitClient.NewUploadPackSession(endpoint, auth)
+	if sessionErr != nil {
+		return "", remoteError(sessionErr, params.GitUrl)
+	}
+	defer session.Close()
+
+	refs, refsErr := session.AdvertisedReferencesContext(ctx)
+	if refsErr != nil {
+		return "", remoteError(refsErr, params.GitUrl)
+	}
+	for _, name := range candidateReferences(params.GitRevision) {
+		if peeled, exists := refs.Peeled[name]; exists {
+			return peeled.String(), nil
+		}
+		if hash, exists := refs.References[name]; exists {
+			return hash.String(), nil
+		}
+	}
+	return "", mutation.RejectionError{Reason: fmt.Sprintf("revision '%s' does not exist in '%s', it is not a branch, a tag or a full commit hash", params.GitRevision, params.GitUrl)}
+}
+
+// readCredentials reads credentials from the Pod's `kind: Secret`, or takes operator defaults when the Pod does not reference a Secret
+func (a MutationRequest) readCredentials(ctx goCtx.Context, namespace string, params appContext.Parameters) (remoteCredentials, error) {
+	if !params.Secret.IsDefined() {
+		return remoteCredentials{username: params.GitUsername, token: params.GitToken}, nil
+	}
+
+	secret, err := a.getSecret(ctx, namespace, params.Secret.Name)
+	if err != nil {
+		return remoteCredentials{}, err
+	}
+
+	read := func(key string) ([]byte, error) {
+		if key == "" {
+			return nil, nil
+		}
+		value, exists := secret.Data[key]
+		if !exists {
+			return nil, mutation.RejectionError{Reason: fmt.Sprintf("secret '%s' does not contain key '%s'", params.Secret.Name, key)}
+		}
+		return value, nil
+	}
+	credentials := remoteCredentials{username: params.GitUsername}
+	var readErr error
+	if credentials.sshKey, readErr = read(params.Secret.SSHKeyKey); readErr != nil {
+		return remoteCredentials{}, readErr
+	}
+	if credentials.knownHosts, readErr = read(params.Secret.KnownHostsKey); readErr != nil {
+		return remoteCredentials{}, readErr
+	}
+	if credentials.passphrase, readErr = read(params.Secret.SSHKeyPassphraseKey); readErr != nil {
+		return remoteCredentials{}, readErr
+	}
+	token, readErr := read(params.Secret.TokenKey)
+	if readErr != nil {
+		return remoteCredentials{}, readErr
+	}
+	credentials.token = string(token)
+	if params.Secret.UsernameKey != "" {
+		username, usernameErr := read(params.Secret.UsernameKey)
+		if usernameErr != nil {
+			return remoteCredentials{}, usernameErr
+		}
+		credentials.username = string(username)
+	}
+	return credentials, nil
+}
+
+// getSecret reads `kind: Secret` from the cache, or from the API when the cache is not configured
+func (a MutationRequest) getSecret(ctx goCtx.Context, namespace string, name string) (*corev1.Secret, error) {
+	if a.Secrets != nil {
+		return a.Secrets.Get(namespace, name)
+	}
+	secret, err := a.Client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, mutation.RejectionError{Reason: fmt.Sprintf("secret '%s' does not exist in namespace '%s'", name, namespace)}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot fetch secret '%s' from namespace '%s'", name, namespace)
+	}
+	return secret, nil
+}
+
+// createAuthMethod creates basic auth for HTTP(S), or SSH public keys with strict host key checking - same as the `checkout` command does
+func createAuthMethod(url string, credentials remoteCredentials) (transport.AuthMethod, error) {
+	if !isSSHUrl(url) {
+		if credentials.token == "" {
+			return nil, nil
+		}
+		username := credentials.username
+		if username == "" {
+			username = appContext.TokenUsername
+		}
+		return &http.BasicAuth{Username: username, Password: credentials.token}, nil
+	}
+
+	if len(credentials.sshKey) == 0 || len(credentials.knownHosts) == 0 {
+		return nil, nil
+	}
+	endpoint, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, mutation.RejectionError{Reason: fmt.Sprintf("cannot parse GIT-SSH url '%s': %v", url, err)}
+	}
+	user := endpoint.User
+	if user == "" {
+		user = "git"
+	}
+	keys, keyErr := gitssh.NewPublicKeys(user, credentials.sshKey, string(credentials.passphrase))
+	if keyErr != nil {
+		return nil, mutation.RejectionError{Reason: fmt.Sprintf("cannot load SSH private key: %v", keyErr)}
+	}
+
+	// known_hosts parser accepts only files
+	knownHosts, tempErr := os.CreateTemp("", "known_hosts")
+	if tempErr != nil {
+		return nil, errors.Wrap(tempErr, "Cannot create a temporary known_hosts file")
+	}
+	defer os.Remove(knownHosts.Name())
+	if _, err := knownHosts.Write(credentials.knownHosts); err != nil {
+		_ = knownHosts.Close()
+		return nil, errors.Wrap(err, "Cannot write a temporary known_hosts file")
+	}
+	_ = knownHosts.Close()
+	callback, callbackErr := gitssh.NewKnownHostsCallback(knownHosts.Name())
+	if callbackErr != nil {
+		return nil, mutation.RejectionError{Reason: fmt.Sprintf("cannot parse known_hosts: %v", callbackErr)}
+	}
+	keys.HostKeyCallback = callback
+	return keys, nil
+}
+
+// candidateReferences lists full reference names the revision could mean, branches take precedence over tags
+func candidateReferences(revision string) []string {
+	if strings.HasPrefix(revision, "refs/") {
+		return []string{revision}
+	}
+	return []string{plumbing.NewBranchReferenceName(revision).String(), plumbing.NewTagReferenceName(revision).String()}
+}
+
+// remoteError turns errors caused by the repository or credentials into a readable denial
+func remoteError(err error, url string) error {
+	for _, known := range []error{transport.ErrRepositoryNotFound, transport.ErrEmptyRemoteRepository, transport.ErrAuthenticationRequired, transport.ErrAuthorizationFailed, transport.ErrInvalidAuthMethod} {
+		if errors.Is(err, known) {
+			return mutation.RejectionError{Reason: fmt.Sprintf("cannot list revisions of '%s': %v", url, err)}
+		}
+	}
+	return errors.Wrapf(err, "Cannot list revisions of '%s'", url)
+}
+
+// isSSHUrl tells if the repository is accessed over SSH protocol e.g. git@github.com:riotkit-org/git-clone-controller.git or ssh://github.com/...
+// A user in HTTP(S) url e.g. https://git@github.com/... does not make it SSH
+func isSSHUrl(url string) bool {
+	endpoint, err := transport.NewEndpoint(url)
+	return err == nil && endpoint.Protocol == "ssh"
+}
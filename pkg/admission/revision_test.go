@@ -0,0 +1,164 @@
+package admission
+
+import (
+	goCtx "context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/riotkit-org/git-clone-controller/pkg/mutation"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// createRemoteRepository creates a local repository with a branch, a lightweight tag and an annotated tag
+func createRemoteRepository(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	repository, _ := git.PlainInit(dir, false)
+	assert.Nil(t, os.WriteFile(dir+"/index.html", []byte("hello"), 0644))
+	w, _ := repository.Worktree()
+	_, _ = w.Add("index.html")
+	signature := &object.Signature{Name: "Kropotkin", Email: "peter@example.org", When: time.Now()}
+	hash, err := w.Commit("Initial", &git.CommitOptions{Author: signature})
+	assert.Nil(t, err)
+
+	_, _ = repository.CreateTag("v1.0.0", hash, nil)
+	_, err = repository.CreateTag("v2.0.0", hash, &git.CreateTagOptions{Tagger: signature, Message: "Release"})
+	assert.Nil(t, err)
+	return "file://" + dir, hash.String()
+}
+
+func TestResolveCommit(t *testing.T) {
+	url, commit := createRemoteRepository(t)
+	request := MutationRequest{PinRevisions: true}
+
+	for _, revision := range []string{"master", "v1.0.0", "v2.0.0", "refs/heads/master"} {
+		resolved, err := request.resolveCommit("anarchism", context.Parameters{GitUrl: url, GitRevision: revision})
+		assert.Nil(t, err)
+		assert.Equal(t, commit, resolved, "Expected that '%s' resolves to the commit (annotated tags are peeled)", revision)
+	}
+
+	// a commit hash does not need resolving
+	resolved, err := request.resolveCommit("anarchism", context.Parameters{GitUrl: url, GitRevision: commit})
+	assert.Nil(t, err)
+	assert.Equal(t, "", resolved)
+
+	_, missingErr := request.resolveCommit("anarchism", context.Parameters{GitUrl: url, GitRevision: "main"})
+	assert.ErrorAs(t, missingErr, &mutation.RejectionError{})
+	assert.Contains(t, missingErr.Error(), "revision 'main' does not exist in")
+}
+
+func TestReadCredentials(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "git-iwa", Namespace: "anarchism"},
+		Data:       map[string][]byte{"token": []byte("solidarity"), "user": []byte("bakunin")},
+	})
+	request := MutationRequest{Client: client, PinRevisions: true}
+
+	credentials, err := request.readCredentials(goCtx.TODO(), "anarchism", context.Parameters{GitUsername: "__token__"}.WithSecret(context.SecretReference{Name: "git-iwa", TokenKey: "token", UsernameKey: "user"}))
+	assert.Nil(t, err)
+	assert.Equal(t, remoteCredentials{username: "bakunin", token: "solidarity"}, credentials)
+
+	_, missingKeyErr := request.readCredentials(goCtx.TODO(), "anarchism", context.Parameters{}.WithSecret(context.SecretReference{Name: "git-iwa", TokenKey: "password"}))
+	assert.ErrorAs(t, missingKeyErr, &mutation.RejectionError{})
+	assert.Contains(t, missingKeyErr.Error(), "does not contain key 'password'")
+
+	_, missingSecretErr := request.readCredentials(goCtx.TODO(), "anarchism", context.Parameters{}.WithSecret(context.SecretReference{Name: "other", TokenKey: "token"}))
+	assert.ErrorAs(t, missingSecretErr, &mutation.RejectionError{})
+}
+
+func TestProcessAdmissionRequest_PinsRevision(t *testing.T) {
+	url, commit := createRemoteRepository(t)
+	raw := `{"kind":"Pod","apiVersion":"v1","metadata":{"name":"test","namespace":"anarchism",` +
+		`"labels":{"riotkit.org/git-clone-controller":"true"},` +
+		`"annotations":{"git-clone-controller/url":"` + url + `","git-clone-controller/revision":"v2.0.0","git-clone-controller/path":"/workspace/source","git-clone-controller/owner":"1000","git-clone-controller/group":"1000"}},` +
+		`"spec":{"containers":[{"name":"app","image":"busybox","volumeMounts":[{"name":"workspace","mountPath":"/workspace"}]}]}}`
+
+	request := MutationRequest{
+		Logger:       logrus.NewEntry(logrus.New()),
+		Request:      &admissionv1.AdmissionRequest{UID: "test", Namespace: "anarchism", Object: runtime.RawExtension{Raw: []byte(raw)}},
+		DefaultImage: "ghcr.io/riotkit-org/git-clone-controller",
+		PinRevisions: true,
+	}
+	request.Request.Kind.Kind = "Pod"
+
+	review, err := request.ProcessAdmissionRequest()
+	assert.Nil(t, err)
+	assert.True(t, review.Response.Allowed)
+	assert.Contains(t, string(review.Response.Patch), `"path":"/metadata/annotations/git-clone-controller~1resolvedCommit","value":"`+commit+`"`)
+	assert.Contains(t, string(review.Response.Patch), `"--commit","`+commit+`"`)
+}
+
+func TestProcessAdmissionRequest_PodFromMutatedTemplateIsNotPinnedAgain(t *testing.T) {
+	lookups := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	// a Pod of a Deployment, which template was already mutated
+	raw := `{"kind":"Pod","apiVersion":"v1","metadata":{"name":"test","namespace":"anarchism",` +
+		`"labels":{"riotkit.org/git-clone-controller":"true"},` +
+		`"annotations":{"git-clone-controller/url":"` + server.URL + `/themes/iwa","git-clone-controller/revision":"main","git-clone-controller/path":"/workspace/source","git-clone-controller/owner":"1000","git-clone-controller/group":"1000",` +
+		`"git-clone-controller/injectedContainers":"git-checkout"}},` +
+		`"spec":{"initContainers":[{"name":"git-checkout","image":"ghcr.io/riotkit-org/git-clone-controller"}],` +
+		`"containers":[{"name":"app","image":"busybox","volumeMounts":[{"name":"workspace","mountPath":"/workspace"}]}]}}`
+
+	request := MutationRequest{
+		Logger:       logrus.NewEntry(logrus.New()),
+		Request:      &admissionv1.AdmissionRequest{UID: "test", Namespace: "anarchism", Object: runtime.RawExtension{Raw: []byte(raw)}},
+		DefaultImage: "ghcr.io/riotkit-org/git-clone-controller",
+		PinRevisions: true,
+	}
+	request.Request.Kind.Kind = "Pod"
+
+	review, err := request.ProcessAdmissionRequest()
+	assert.Nil(t, err)
+	assert.True(t, review.Response.Allowed)
+	assert.Nil(t, review.Response.Patch)
+	assert.Equal(t, 0, lookups, "Expected that the remote repository is not queried for an already mutated Pod")
+}
+
+func TestCreateAuthMethod_EncryptedSSHKey(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(private, "", []byte("no gods no masters"))
+	assert.Nil(t, err)
+	publicKey, _ := ssh.NewPublicKey(public)
+	credentials := remoteCredentials{
+		sshKey:     pem.EncodeToMemory(block),
+		knownHosts: []byte(knownhosts.Line([]string{"git.example.org"}, publicKey) + "\n"),
+		passphrase: []byte("no gods no masters"),
+	}
+
+	auth, err := createAuthMethod("git@git.example.org:themes/iwa.git", credentials)
+	assert.Nil(t, err)
+	assert.Equal(t, "git", auth.(*gitssh.PublicKeys).User)
+
+	credentials.passphrase = nil
+	_, missingErr := createAuthMethod("git@git.example.org:themes/iwa.git", credentials)
+	assert.ErrorAs(t, missingErr, &mutation.RejectionError{})
+}
+
+func TestIsSSHUrl(t *testing.T) {
+	assert.True(t, isSSHUrl("git@github.com:riotkit-org/git-clone-controller.git"))
+	assert.True(t, isSSHUrl("ssh://deploy@git.example.org:2222/themes/iwa.git"))
+	assert.False(t, isSSHUrl("https://git@github.com/riotkit-org/git-clone-controller.git"))
+	assert.False(t, isSSHUrl("https://github.com/riotkit-org/git-clone-controller.git"))
+}
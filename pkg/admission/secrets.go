@@ -0,0 +1,89 @@
+package admission
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/riotkit-org/git-clone-controller/pkg/mutation"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"time"
+)
+
+// SecretCache keeps `kind: Secret` in memory using informers, so the admission does not wait for the API.
+// The cache is scoped to secrets matching a label selector and/or to selected namespaces, to limit memory usage and access
+type SecretCache struct {
+	factories     []informers.SharedInformerFactory
+	listers       map[string]corelisters.SecretLister
+	synced        []cache.InformerSynced
+	labelSelector string
+}
+
+// NewSecretCache creates a cache of secrets from given namespaces (all namespaces, when empty) matching optional label selector
+func NewSecretCache(client kubernetes.Interface, resync time.Duration, labelSelector string, namespaces []string) *SecretCache {
+	c := &SecretCache{listers: map[string]corelisters.SecretLister{}, labelSelector: labelSelector}
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	for _, namespace := range namespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(client, resync,
+			informers.WithNamespace(namespace),
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.LabelSelector = labelSelector
+			}),
+		)
+		secrets := factory.Core().V1().Secrets()
+		c.factories = append(c.factories, factory)
+		c.listers[namespace] = secrets.Lister()
+		c.synced = append(c.synced, secrets.Informer().HasSynced)
+	}
+	return c
+}
+
+// Start begins watching secrets in background
+func (c *SecretCache) Start(stopCh <-chan struct{}) {
+	for _, factory := range c.factories {
+		factory.Start(stopCh)
+	}
+}
+
+// HasSynced tells if all secrets were initially loaded
+func (c *SecretCache) HasSynced() bool {
+	for _, synced := range c.synced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns a secret from the cache. Secrets outside the watched namespaces, or not matching the label selector are not found
+func (c *SecretCache) Get(namespace string, name string) (*corev1.Secret, error) {
+	if !c.HasSynced() {
+		return nil, errors.New("secrets are not loaded yet")
+	}
+	lister, watched := c.listers[namespace]
+	if !watched {
+		lister, watched = c.listers[metav1.NamespaceAll]
+	}
+	if !watched {
+		return nil, mutation.RejectionError{Reason: fmt.Sprintf("secrets from namespace '%s' are not accessible by git-clone-controller", namespace)}
+	}
+
+	secret, err := lister.Secrets(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		hint := ""
+		if c.labelSelector != "" {
+			hint = fmt.Sprintf(" or is not labelled with '%s'", c.labelSelector)
+		}
+		return nil, mutation.RejectionError{Reason: fmt.Sprintf("secret '%s' does not exist in namespace '%s'%s", name, namespace, hint)}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot read secret '%s' from namespace '%s'", name, namespace)
+	}
+	return secret, nil
+}
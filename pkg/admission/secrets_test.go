@@ -0,0 +1,84 @@
+package admission
+
+import (
+	goCtx "context"
+	"testing"
+	"time"
+
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/riotkit-org/git-clone-controller/pkg/mutation"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func createSecretsClient() *fake.Clientset {
+	return fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "git-secrets", Namespace: "anarchism", Labels: map[string]string{"riotkit.org/git-clone-controller": "true"}},
+			Data:       map[string][]byte{"gitToken": []byte("bakunin")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "unlabelled", Namespace: "anarchism"},
+			Data:       map[string][]byte{"gitToken": []byte("proudhon")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "git-secrets", Namespace: "syndicalism", Labels: map[string]string{"riotkit.org/git-clone-controller": "true"}},
+			Data:       map[string][]byte{"gitToken": []byte("rocker")},
+		},
+	)
+}
+
+func startSecretCache(t *testing.T, secrets *SecretCache) {
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	secrets.Start(stop)
+	assert.True(t, cache.WaitForCacheSync(stop, secrets.HasSynced))
+}
+
+func TestSecretCache_ScopedByLabelSelector(t *testing.T) {
+	secrets := NewSecretCache(createSecretsClient(), time.Minute, "riotkit.org/git-clone-controller=true", nil)
+	startSecretCache(t, secrets)
+
+	secret, err := secrets.Get("syndicalism", "git-secrets")
+	assert.Nil(t, err)
+	assert.Equal(t, "rocker", string(secret.Data["gitToken"]))
+
+	_, unlabelledErr := secrets.Get("anarchism", "unlabelled")
+	assert.ErrorAs(t, unlabelledErr, &mutation.RejectionError{})
+	assert.Contains(t, unlabelledErr.Error(), "secret 'unlabelled' does not exist in namespace 'anarchism' or is not labelled with 'riotkit.org/git-clone-controller=true'")
+}
+
+func TestSecretCache_ScopedByNamespaces(t *testing.T) {
+	secrets := NewSecretCache(createSecretsClient(), time.Minute, "", []string{"anarchism"})
+	startSecretCache(t, secrets)
+
+	secret, err := secrets.Get("anarchism", "unlabelled")
+	assert.Nil(t, err)
+	assert.Equal(t, "proudhon", string(secret.Data["gitToken"]))
+
+	_, namespaceErr := secrets.Get("syndicalism", "git-secrets")
+	assert.ErrorAs(t, namespaceErr, &mutation.RejectionError{})
+	assert.Contains(t, namespaceErr.Error(), "secrets from namespace 'syndicalism' are not accessible")
+}
+
+func TestSecretCache_NotSynced(t *testing.T) {
+	secrets := NewSecretCache(createSecretsClient(), time.Minute, "", nil)
+	assert.False(t, secrets.HasSynced())
+
+	_, err := secrets.Get("anarchism", "git-secrets")
+	assert.NotNil(t, err)
+}
+
+func TestReadCredentials_FromCache(t *testing.T) {
+	secrets := NewSecretCache(createSecretsClient(), time.Minute, "riotkit.org/git-clone-controller=true", nil)
+	startSecretCache(t, secrets)
+
+	// no API client, credentials must come from the cache
+	request := MutationRequest{Secrets: secrets}
+	credentials, err := request.readCredentials(goCtx.TODO(), "anarchism", context.Parameters{}.WithSecret(context.SecretReference{Name: "git-secrets", TokenKey: "gitToken"}))
+	assert.Nil(t, err)
+	assert.Equal(t, "bakunin", credentials.token)
+}
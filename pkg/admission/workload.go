@@ -0,0 +1,127 @@
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/riotkit-org/git-clone-controller/pkg/mutation"
+	"github.com/sirupsen/logrus"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"net/http"
+)
+
+// isWorkload tells if given kind has a Pod template that could be mutated
+func isWorkload(kind string) bool {
+	switch kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "Job", "CronJob":
+		return true
+	}
+	return false
+}
+
+// ResolveWorkload extracts a workload and a pointer to its Pod template from an admission request
+func ResolveWorkload(a MutationRequest) (runtime.Object, *corev1.PodTemplateSpec, error) {
+	if a.IsDebugLevel {
+		logrus.Printf("Processing request: %v", string(a.Request.Object.Raw))
+	}
+	return decodeWorkload(a.Request.Kind.Kind, a.Request.Object.Raw)
+}
+
+// decodeWorkload decodes a workload of given kind and returns a pointer to its Pod template
+func decodeWorkload(kind string, raw []byte) (runtime.Object, *corev1.PodTemplateSpec, error) {
+	var workload runtime.Object
+	var template *corev1.PodTemplateSpec
+	switch kind {
+	case "Deployment":
+		deployment := &appsv1.Deployment{}
+		workload, template = deployment, &deployment.Spec.Template
+	case "StatefulSet":
+		statefulSet := &appsv1.StatefulSet{}
+		workload, template = statefulSet, &statefulSet.Spec.Template
+	case "DaemonSet":
+		daemonSet := &appsv1.DaemonSet{}
+		workload, template = daemonSet, &daemonSet.Spec.Template
+	case "Job":
+		job := &batchv1.Job{}
+		workload, template = job, &job.Spec.Template
+	case "CronJob":
+		cronJob := &batchv1.CronJob{}
+		workload, template = cronJob, &cronJob.Spec.JobTemplate.Spec.Template
+	default:
+		return nil, nil, fmt.Errorf("unsupported workload type: %v", kind)
+	}
+
+	if err := json.Unmarshal(raw, workload); err != nil {
+		return nil, nil, err
+	}
+	return workload, template, nil
+}
+
+// previousTemplate returns the Pod template of the workload before an update, nothing when the workload is created
+func (a MutationRequest) previousTemplate() *corev1.Pod {
+	if a.Request.Operation != admissionv1.Update || len(a.Request.OldObject.Raw) == 0 {
+		return nil
+	}
+	_, template, err := decodeWorkload(a.Request.Kind.Kind, a.Request.OldObject.Raw)
+	if err != nil {
+		logrus.Warnf("Cannot parse previous version of %s '%s/%s': %v", a.Request.Kind.Kind, a.Request.Namespace, a.Request.Name, err)
+		return nil
+	}
+	return &corev1.Pod{ObjectMeta: template.ObjectMeta, Spec: template.Spec}
+}
+
+// processWorkloadAdmissionRequest mutates the Pod template of a workload, so the initContainer is visible in the workload specification.
+// Annotations are validated when the workload is created or updated, instead of when its Pods are created.
+// Jobs are mutated only when created, other workloads keep their pinned commit on update
+func (a MutationRequest) processWorkloadAdmissionRequest() admissionResult {
+	workload, template, err := ResolveWorkload(a)
+	if err != nil {
+		e := fmt.Sprintf("could not parse workload in admission review request: %v", err)
+		return admissionResult{reviewResponse(a.Request.UID, false, http.StatusBadRequest, e), ReasonInvalidObject, err}
+	}
+	original := workload.DeepCopyObject()
+
+	// Pod template of a Job is immutable, a newly pinned commit would reject any other update of the Job
+	if a.Request.Kind.Kind == "Job" && a.Request.Operation == admissionv1.Update {
+		return admissionResult{reviewResponse(a.Request.UID, true, http.StatusOK, ""), ReasonUnchanged, nil}
+	}
+
+	pod := &corev1.Pod{ObjectMeta: *template.ObjectMeta.DeepCopy(), Spec: *template.Spec.DeepCopy()}
+	pod.Namespace = a.Request.Namespace
+	log := logrus.WithField("workload", fmt.Sprintf("%s/%s", a.Request.Kind.Kind, a.Request.Name))
+
+	// previously injected containers are removed also when the workload is no longer labelled
+	mutatedPod := mutation.RemoveInjected(pod)
+	if isPodToBeProcessed(pod) {
+		parametersList, denial := a.resolveParameters(pod, a.previousTemplate())
+		if denial != nil {
+			return *denial
+		}
+		mutated, mutateErr := mutation.MutatePodTemplate(pod, log, parametersList...)
+		if mutateErr != nil {
+			return mutationErrorResponse(a.Request.UID, mutateErr, ReasonMutationFailed)
+		}
+		mutatedPod = mutated
+	}
+
+	mutatedPod.Namespace = template.Namespace
+	template.ObjectMeta = mutatedPod.ObjectMeta
+	template.Spec = mutatedPod.Spec
+
+	patch, err := createPatch(original, workload)
+	if err != nil {
+		return mutationErrorResponse(a.Request.UID, err, ReasonMutationFailed)
+	}
+	if string(patch) == "null" {
+		reason := ReasonNotLabelled
+		if isPodToBeProcessed(pod) {
+			reason = ReasonUnchanged
+		}
+		return admissionResult{reviewResponse(a.Request.UID, true, http.StatusOK, ""), reason, nil}
+	}
+	review, err := patchReviewResponse(a.Request.UID, patch)
+	return admissionResult{review, ReasonMutated, err}
+}
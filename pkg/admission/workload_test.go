@@ -0,0 +1,137 @@
+package admission
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const exampleTemplate = `{"metadata":{` +
+	`"labels":{"app":"wordpress","riotkit.org/git-clone-controller":"true"},` +
+	`"annotations":{"git-clone-controller/url":"https://git.example.org/themes/iwa","git-clone-controller/path":"/workspace/source","git-clone-controller/owner":"1000","git-clone-controller/group":"1000"}},` +
+	`"spec":{"containers":[{"name":"app","image":"busybox","volumeMounts":[{"name":"workspace","mountPath":"/workspace"}]}]}}`
+
+const exampleDeployment = `{"kind":"Deployment","apiVersion":"apps/v1","metadata":{"name":"wordpress","namespace":"anarchism","labels":{"riotkit.org/git-clone-controller":"true"}},` +
+	`"spec":{"selector":{"matchLabels":{"app":"wordpress"}},"template":` + exampleTemplate + `}}`
+
+func processWorkload(t *testing.T, kind string, raw string) *admissionv1.AdmissionReview {
+	request := MutationRequest{
+		Logger:          logrus.NewEntry(logrus.New()),
+		Request:         &admissionv1.AdmissionRequest{UID: "test", Namespace: "anarchism", Name: "wordpress", Object: runtime.RawExtension{Raw: []byte(raw)}},
+		DefaultImage:    "ghcr.io/riotkit-org/git-clone-controller",
+		MutateWorkloads: true,
+	}
+	request.Request.Kind.Kind = kind
+
+	review, err := request.ProcessAdmissionRequest()
+	assert.Nil(t, err)
+	return review
+}
+
+func TestProcessAdmissionRequest_MutatesDeploymentTemplate(t *testing.T) {
+	review := processWorkload(t, "Deployment", exampleDeployment)
+
+	assert.True(t, review.Response.Allowed)
+	assert.Contains(t, string(review.Response.Patch), `"path":"/spec/template/spec/initContainers"`)
+	assert.Contains(t, string(review.Response.Patch), "git-checkout")
+	assert.Contains(t, string(review.Response.Patch), "git-clone-controller~1injectedContainers")
+	assert.NotContains(t, string(review.Response.Patch), `"namespace"`, "Expected that the namespace is not added to the template")
+}
+
+func TestProcessAdmissionRequest_MutatesCronJobTemplate(t *testing.T) {
+	raw := `{"kind":"CronJob","apiVersion":"batch/v1","metadata":{"name":"backup","namespace":"anarchism"},` +
+		`"spec":{"schedule":"@daily","jobTemplate":{"spec":{"template":` + exampleTemplate + `}}}}`
+
+	review := processWorkload(t, "CronJob", raw)
+
+	assert.True(t, review.Response.Allowed)
+	assert.Contains(t, string(review.Response.Patch), `"path":"/spec/jobTemplate/spec/template/spec/initContainers"`)
+}
+
+func TestProcessAdmissionRequest_DeniesWorkloadWithInvalidAnnotations(t *testing.T) {
+	raw := strings.Replace(exampleDeployment, `"git-clone-controller/owner":"1000"`, `"git-clone-controller/depth":"many"`, 1)
+
+	request := MutationRequest{
+		Logger:          logrus.NewEntry(logrus.New()),
+		Request:         &admissionv1.AdmissionRequest{UID: "test", Namespace: "anarchism", Object: runtime.RawExtension{Raw: []byte(raw)}},
+		DefaultImage:    "ghcr.io/riotkit-org/git-clone-controller",
+		MutateWorkloads: true,
+	}
+	request.Request.Kind.Kind = "Deployment"
+
+	review, _ := request.ProcessAdmissionRequest()
+	assert.False(t, review.Response.Allowed)
+	assert.Equal(t, int32(http.StatusBadRequest), review.Response.Result.Code)
+	assert.Contains(t, review.Response.Result.Message, "Cannot parse Pod labels/annotations")
+}
+
+func TestProcessAdmissionRequest_RemovesInjectedContainersFromUnlabelledWorkload(t *testing.T) {
+	raw := `{"kind":"StatefulSet","apiVersion":"apps/v1","metadata":{"name":"wordpress","namespace":"anarchism"},` +
+		`"spec":{"selector":{"matchLabels":{"app":"wordpress"}},"template":{"metadata":{"labels":{"app":"wordpress"},` +
+		`"annotations":{"git-clone-controller/injectedContainers":"git-checkout","git-clone-controller/injectedVolumes":""}},` +
+		`"spec":{"initContainers":[{"name":"git-checkout","image":"ghcr.io/riotkit-org/git-clone-controller"}],"containers":[{"name":"app","image":"busybox"}]}}}}`
+
+	review := processWorkload(t, "StatefulSet", raw)
+
+	assert.True(t, review.Response.Allowed)
+	assert.Contains(t, string(review.Response.Patch), `"op":"remove","path":"/spec/template/spec/initContainers"`)
+
+	// nothing to do
+	unlabelled := processWorkload(t, "Deployment", strings.Replace(exampleDeployment, `"riotkit.org/git-clone-controller":"true"},"annotations"`, `"other":"true"},"annotations"`, 1))
+	assert.True(t, unlabelled.Response.Allowed)
+	assert.Nil(t, unlabelled.Response.Patch)
+}
+
+func TestProcessAdmissionRequest_UpdatedWorkloadKeepsPinnedCommit(t *testing.T) {
+	lookups := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	pinned := "8b2f1e54c4b2d5ec3e3c1a5c42b8a2d97a1c0f3e"
+	deployment := func(revision string, extra string) string {
+		template := strings.Replace(exampleTemplate, `"git-clone-controller/url":"https://git.example.org/themes/iwa"`,
+			`"git-clone-controller/url":"`+server.URL+`/themes/iwa","git-clone-controller/revision":"`+revision+`"`+extra, 1)
+		return strings.Replace(exampleDeployment, exampleTemplate, template, 1)
+	}
+	update := func(kind string, old string, updated string) *admissionv1.AdmissionReview {
+		request := MutationRequest{
+			Logger: logrus.NewEntry(logrus.New()),
+			Request: &admissionv1.AdmissionRequest{UID: "test", Namespace: "anarchism", Name: "wordpress", Operation: admissionv1.Update,
+				Object: runtime.RawExtension{Raw: []byte(updated)}, OldObject: runtime.RawExtension{Raw: []byte(old)}},
+			DefaultImage:    "ghcr.io/riotkit-org/git-clone-controller",
+			MutateWorkloads: true,
+			PinRevisions:    true,
+		}
+		request.Request.Kind.Kind = kind
+		review, _ := request.ProcessAdmissionRequest()
+		return review
+	}
+	previous := deployment("main", `,"git-clone-controller/resolvedCommit":"`+pinned+`"`)
+
+	// e.g. a label was added, the branch is not resolved again
+	review := update("Deployment", previous, previous)
+	assert.True(t, review.Response.Allowed)
+	assert.Contains(t, string(review.Response.Patch), `"--commit","`+pinned+`"`)
+	assert.Equal(t, 0, lookups)
+
+	// the revision was changed
+	changed := update("Deployment", previous, deployment("v2.0", `,"git-clone-controller/resolvedCommit":"`+pinned+`"`))
+	assert.False(t, changed.Response.Allowed)
+	assert.Equal(t, 1, lookups)
+
+	// Pod template of a Job is immutable
+	job := strings.Replace(strings.Replace(previous, `"kind":"Deployment","apiVersion":"apps/v1"`, `"kind":"Job","apiVersion":"batch/v1"`, 1), `"selector":{"matchLabels":{"app":"wordpress"}},`, "", 1)
+	unchanged := update("Job", job, strings.Replace(job, `"namespace":"anarchism"`, `"namespace":"anarchism","annotations":{"team":"iwa"}`, 1))
+	assert.True(t, unchanged.Response.Allowed)
+	assert.Nil(t, unchanged.Response.Patch)
+	assert.Equal(t, 1, lookups)
+}
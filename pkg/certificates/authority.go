@@ -0,0 +1,146 @@
+// Package certificates issues the webhook's serving certificate from a CA kept in a `kind: Secret`,
+// and keeps `caBundle` of the `kind: MutatingWebhookConfiguration` in sync with that CA
+package certificates
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/pkg/errors"
+	"math/big"
+	"time"
+)
+
+// Authority is a CA, that signs the webhook's serving certificate
+type Authority struct {
+	Certificate    *x509.Certificate
+	CertificatePEM []byte
+	Key            crypto.Signer
+	KeyPEM         []byte
+}
+
+// NewAuthority generates a self-signed CA
+func NewAuthority(commonName string, validity time.Duration) (*Authority, error) {
+	key, keyErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if keyErr != nil {
+		return nil, errors.Wrap(keyErr, "cannot generate CA key")
+	}
+	serial, serialErr := newSerialNumber()
+	if serialErr != nil {
+		return nil, serialErr
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, certErr := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if certErr != nil {
+		return nil, errors.Wrap(certErr, "cannot create CA certificate")
+	}
+	keyDer, marshalErr := x509.MarshalECPrivateKey(key)
+	if marshalErr != nil {
+		return nil, errors.Wrap(marshalErr, "cannot encode CA key")
+	}
+	return ParseAuthority(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	)
+}
+
+// ParseAuthority reads a PEM encoded CA certificate and its key (PKCS#1, PKCS#8 or EC)
+func ParseAuthority(certPEM []byte, keyPEM []byte) (*Authority, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, errors.New("CA certificate is not PEM encoded")
+	}
+	certificate, certErr := x509.ParseCertificate(certBlock.Bytes)
+	if certErr != nil {
+		return nil, errors.Wrap(certErr, "cannot parse CA certificate")
+	}
+	if !certificate.IsCA {
+		return nil, errors.Errorf("certificate '%s' is not a CA", certificate.Subject.CommonName)
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, errors.New("CA key is not PEM encoded")
+	}
+	key, keyErr := parsePrivateKey(keyBlock.Bytes)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	return &Authority{Certificate: certificate, CertificatePEM: certPEM, Key: key, KeyPEM: keyPEM}, nil
+}
+
+// Issue signs a serving certificate for given DNS names. The certificate never outlives the CA
+func (a *Authority) Issue(dnsNames []string, validity time.Duration) (*tls.Certificate, error) {
+	key, keyErr := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if keyErr != nil {
+		return nil, errors.Wrap(keyErr, "cannot generate serving key")
+	}
+	serial, serialErr := newSerialNumber()
+	if serialErr != nil {
+		return nil, serialErr
+	}
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(a.Certificate.NotAfter) {
+		notAfter = a.Certificate.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, certErr := x509.CreateCertificate(rand.Reader, template, a.Certificate, &key.PublicKey, a.Key)
+	if certErr != nil {
+		return nil, errors.Wrap(certErr, "cannot sign serving certificate")
+	}
+	leaf, parseErr := x509.ParseCertificate(der)
+	if parseErr != nil {
+		return nil, errors.Wrap(parseErr, "cannot parse serving certificate")
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// parsePrivateKey reads keys in any format commonly produced by openssl or cert-manager
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		signer, isSigner := key.(crypto.Signer)
+		if !isSigner {
+			return nil, errors.New("CA key cannot be used for signing")
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("cannot parse CA key, expected PKCS#1, PKCS#8 or EC private key")
+}
+
+// newSerialNumber generates a random 128-bit serial number
+func newSerialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot generate serial number")
+	}
+	return serial, nil
+}
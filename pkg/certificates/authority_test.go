@@ -0,0 +1,38 @@
+package certificates
+
+import (
+	"crypto/x509"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAuthority_IssuesServingCertificate(t *testing.T) {
+	authority, err := NewAuthority("git-clone-controller-ca", time.Hour*24)
+	assert.Nil(t, err)
+
+	certificate, issueErr := authority.Issue([]string{"git-clone-controller.default.svc"}, time.Hour)
+	assert.Nil(t, issueErr)
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(authority.CertificatePEM)
+	_, verifyErr := certificate.Leaf.Verify(x509.VerifyOptions{DNSName: "git-clone-controller.default.svc", Roots: roots})
+	assert.Nil(t, verifyErr)
+}
+
+func TestAuthority_CertificateDoesNotOutliveCA(t *testing.T) {
+	authority, _ := NewAuthority("git-clone-controller-ca", time.Hour)
+	certificate, err := authority.Issue([]string{"git-clone-controller.default.svc"}, time.Hour*24)
+	assert.Nil(t, err)
+	assert.Equal(t, authority.Certificate.NotAfter, certificate.Leaf.NotAfter)
+}
+
+func TestParseAuthority_RejectsNonCA(t *testing.T) {
+	authority, _ := NewAuthority("git-clone-controller-ca", time.Hour)
+	parsed, err := ParseAuthority(authority.CertificatePEM, authority.KeyPEM)
+	assert.Nil(t, err)
+	assert.Equal(t, "git-clone-controller-ca", parsed.Certificate.Subject.CommonName)
+
+	_, invalidErr := ParseAuthority([]byte("not a certificate"), authority.KeyPEM)
+	assert.NotNil(t, invalidErr)
+}
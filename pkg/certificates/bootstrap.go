@@ -0,0 +1,224 @@
+package certificates
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"time"
+)
+
+const (
+	// SecretCertificateKey, SecretKeyKey and SecretPreviousCertificateKey are keys of the CA `kind: Secret`.
+	// The previous CA is kept in `caBundle` after rotation, until it expires
+	SecretCertificateKey         = "ca.crt"
+	SecretKeyKey                 = "ca.key"
+	SecretPreviousCertificateKey = "ca-previous.crt"
+
+	authorityValidity = 10 * 365 * 24 * time.Hour
+	servingValidity   = 365 * 24 * time.Hour
+)
+
+// Bootstrapper keeps the webhook's certificates valid without external tools: the CA is stored in a `kind: Secret`
+// shared by all replicas, each replica issues its own serving certificate and `caBundle` is patched through the API
+type Bootstrapper struct {
+	Client                   kubernetes.Interface
+	Namespace                string
+	SecretName               string
+	ServiceName              string
+	WebhookConfigurationName string
+}
+
+// DNSNames lists names the API server may use to reach the webhook's Service
+func (b *Bootstrapper) DNSNames() []string {
+	return []string{
+		fmt.Sprintf("%s.%s.svc", b.ServiceName, b.Namespace),
+		b.ServiceName,
+		fmt.Sprintf("%s.%s", b.ServiceName, b.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", b.ServiceName, b.Namespace),
+	}
+}
+
+// Bootstrap loads (or generates) the CA, patches `caBundle` and issues a serving certificate
+func (b *Bootstrapper) Bootstrap(ctx context.Context) (*tls.Certificate, error) {
+	authority, bundle, err := b.LoadAuthority(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.PatchCABundle(ctx, bundle); err != nil {
+		return nil, err
+	}
+	return authority.Issue(b.DNSNames(), servingValidity)
+}
+
+// Watch periodically re-applies `caBundle` (e.g. after the configuration was re-applied) and renews the serving certificate
+// after 2/3 of its lifetime, or when the CA was rotated. Renewed certificate is passed to onRenew
+func (b *Bootstrapper) Watch(ctx context.Context, current *tls.Certificate, interval time.Duration, onRenew func(*tls.Certificate)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		authority, bundle, err := b.LoadAuthority(ctx)
+		if err != nil {
+			logrus.Errorf("Cannot load webhook CA: %v", err)
+			continue
+		}
+		if err := b.PatchCABundle(ctx, bundle); err != nil {
+			logrus.Errorf("Cannot patch caBundle: %v", err)
+		}
+		if !needsRenewal(current.Leaf, authority, time.Now()) {
+			continue
+		}
+		renewed, issueErr := authority.Issue(b.DNSNames(), servingValidity)
+		if issueErr != nil {
+			logrus.Errorf("Cannot renew serving certificate: %v", issueErr)
+			continue
+		}
+		logrus.Infof("Serving certificate renewed, valid until %s", renewed.Leaf.NotAfter.Format(time.RFC3339))
+		current = renewed
+		onRenew(renewed)
+	}
+}
+
+// LoadAuthority reads the CA from the `kind: Secret`. The CA is generated when the Secret does not exist,
+// and rotated when it would expire before a newly issued serving certificate. Returns the CA and the `caBundle` to trust
+func (b *Bootstrapper) LoadAuthority(ctx context.Context) (*Authority, []byte, error) {
+	var authority *Authority
+	var bundle []byte
+
+	// replicas may start at the same time, the loser of a race reads what the winner stored
+	err := retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		secret, getErr := b.Client.CoreV1().Secrets(b.Namespace).Get(ctx, b.SecretName, metav1.GetOptions{})
+		if apierrors.IsNotFound(getErr) {
+			var createErr error
+			authority, bundle, createErr = b.createAuthority(ctx)
+			return createErr
+		}
+		if getErr != nil {
+			return errors.Wrapf(getErr, "cannot read CA secret '%s/%s'", b.Namespace, b.SecretName)
+		}
+
+		current, parseErr := ParseAuthority(secret.Data[SecretCertificateKey], secret.Data[SecretKeyKey])
+		if parseErr != nil {
+			return errors.Wrapf(parseErr, "cannot parse CA from secret '%s/%s'", b.Namespace, b.SecretName)
+		}
+		if time.Now().Add(servingValidity).Before(current.Certificate.NotAfter) {
+			authority, bundle = current, caBundle(current.CertificatePEM, secret.Data[SecretPreviousCertificateKey])
+			return nil
+		}
+
+		var rotateErr error
+		authority, bundle, rotateErr = b.rotateAuthority(ctx, secret, current)
+		return rotateErr
+	})
+	return authority, bundle, err
+}
+
+// createAuthority generates a CA and stores it in a new `kind: Secret`
+func (b *Bootstrapper) createAuthority(ctx context.Context) (*Authority, []byte, error) {
+	authority, err := NewAuthority(b.ServiceName+"-ca", authorityValidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: b.SecretName, Namespace: b.Namespace},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{SecretCertificateKey: authority.CertificatePEM, SecretKeyKey: authority.KeyPEM},
+	}
+	if _, createErr := b.Client.CoreV1().Secrets(b.Namespace).Create(ctx, secret, metav1.CreateOptions{}); createErr != nil {
+		return nil, nil, createErr
+	}
+	logrus.Infof("Generated webhook CA, stored in secret '%s/%s'", b.Namespace, b.SecretName)
+	return authority, authority.CertificatePEM, nil
+}
+
+// rotateAuthority replaces an expiring CA. The previous CA stays trusted, so certificates of other replicas keep working until renewed
+func (b *Bootstrapper) rotateAuthority(ctx context.Context, secret *corev1.Secret, previous *Authority) (*Authority, []byte, error) {
+	authority, err := NewAuthority(b.ServiceName+"-ca", authorityValidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret = secret.DeepCopy()
+	secret.Data = map[string][]byte{
+		SecretCertificateKey:         authority.CertificatePEM,
+		SecretKeyKey:                 authority.KeyPEM,
+		SecretPreviousCertificateKey: previous.CertificatePEM,
+	}
+	if _, updateErr := b.Client.CoreV1().Secrets(b.Namespace).Update(ctx, secret, metav1.UpdateOptions{}); updateErr != nil {
+		return nil, nil, updateErr
+	}
+	logrus.Infof("Webhook CA expires at %s, rotated", previous.Certificate.NotAfter.Format(time.RFC3339))
+	return authority, caBundle(authority.CertificatePEM, previous.CertificatePEM), nil
+}
+
+// PatchCABundle sets `caBundle` of all webhooks in the `kind: MutatingWebhookConfiguration`, when it differs
+func (b *Bootstrapper) PatchCABundle(ctx context.Context, bundle []byte) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configurations := b.Client.AdmissionregistrationV1().MutatingWebhookConfigurations()
+		configuration, err := configurations.Get(ctx, b.WebhookConfigurationName, metav1.GetOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "cannot read MutatingWebhookConfiguration '%s'", b.WebhookConfigurationName)
+		}
+		changed := false
+		for i := range configuration.Webhooks {
+			if !bytes.Equal(configuration.Webhooks[i].ClientConfig.CABundle, bundle) {
+				configuration.Webhooks[i].ClientConfig.CABundle = bundle
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		if _, err := configurations.Update(ctx, configuration, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		logrus.Infof("Patched caBundle of MutatingWebhookConfiguration '%s'", b.WebhookConfigurationName)
+		return nil
+	})
+}
+
+// caBundle joins the current CA with the previous one, as long as the previous one is still valid
+func caBundle(current []byte, previous []byte) []byte {
+	if len(previous) == 0 {
+		return current
+	}
+	previousAuthority, err := x509.ParseCertificate(decodeCertificate(previous))
+	if err != nil || time.Now().After(previousAuthority.NotAfter) {
+		return current
+	}
+	return append(append(append([]byte{}, current...), '\n'), previous...)
+}
+
+// needsRenewal tells if the serving certificate passed 2/3 of its lifetime, or was not signed by the current CA
+func needsRenewal(leaf *x509.Certificate, authority *Authority, now time.Time) bool {
+	if leaf == nil || leaf.CheckSignatureFrom(authority.Certificate) != nil {
+		return true
+	}
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return now.After(leaf.NotBefore.Add(lifetime * 2 / 3))
+}
+
+// decodeCertificate returns DER bytes of the first PEM block
+func decodeCertificate(certPEM []byte) []byte {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil
+	}
+	return block.Bytes
+}
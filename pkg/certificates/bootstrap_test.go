@@ -0,0 +1,81 @@
+package certificates
+
+import (
+	"context"
+	"crypto/x509"
+	"github.com/stretchr/testify/assert"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+func createBootstrapper() *Bootstrapper {
+	client := fake.NewSimpleClientset(&admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "git-clone-controller"},
+		Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "pods"}, {Name: "workloads"}},
+	})
+	return &Bootstrapper{
+		Client:                   client,
+		Namespace:                "git-clone-controller",
+		SecretName:               "git-clone-controller-ca",
+		ServiceName:              "git-clone-controller",
+		WebhookConfigurationName: "git-clone-controller",
+	}
+}
+
+func TestBootstrapper_GeneratesCAAndPatchesCABundle(t *testing.T) {
+	b := createBootstrapper()
+	certificate, err := b.Bootstrap(context.TODO())
+	assert.Nil(t, err)
+
+	secret, _ := b.Client.CoreV1().Secrets("git-clone-controller").Get(context.TODO(), "git-clone-controller-ca", metav1.GetOptions{})
+	configuration, _ := b.Client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), "git-clone-controller", metav1.GetOptions{})
+	for _, webhook := range configuration.Webhooks {
+		assert.Equal(t, secret.Data[SecretCertificateKey], webhook.ClientConfig.CABundle)
+	}
+
+	// the API server has to trust the serving certificate
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(configuration.Webhooks[0].ClientConfig.CABundle)
+	_, verifyErr := certificate.Leaf.Verify(x509.VerifyOptions{DNSName: "git-clone-controller.git-clone-controller.svc", Roots: roots})
+	assert.Nil(t, verifyErr)
+}
+
+func TestBootstrapper_ReplicasShareCA(t *testing.T) {
+	b := createBootstrapper()
+	first, _, err := b.LoadAuthority(context.TODO())
+	assert.Nil(t, err)
+	second, _, err := b.LoadAuthority(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, first.CertificatePEM, second.CertificatePEM)
+}
+
+func TestBootstrapper_RotatesExpiringCA(t *testing.T) {
+	b := createBootstrapper()
+	expiring, _ := NewAuthority("git-clone-controller-ca", 30*24*time.Hour)
+	_, _ = b.Client.CoreV1().Secrets("git-clone-controller").Create(context.TODO(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "git-clone-controller-ca", Namespace: "git-clone-controller"},
+		Data:       map[string][]byte{SecretCertificateKey: expiring.CertificatePEM, SecretKeyKey: expiring.KeyPEM},
+	}, metav1.CreateOptions{})
+
+	authority, bundle, err := b.LoadAuthority(context.TODO())
+	assert.Nil(t, err)
+	assert.NotEqual(t, expiring.CertificatePEM, authority.CertificatePEM)
+
+	// certificates issued by the previous CA are still trusted
+	assert.Contains(t, string(bundle), string(expiring.CertificatePEM))
+	assert.Contains(t, string(bundle), string(authority.CertificatePEM))
+}
+
+func TestNeedsRenewal(t *testing.T) {
+	authority, _ := NewAuthority("git-clone-controller-ca", 24*time.Hour)
+	other, _ := NewAuthority("git-clone-controller-ca", 24*time.Hour)
+	certificate, _ := authority.Issue([]string{"git-clone-controller"}, 3*time.Hour)
+
+	assert.False(t, needsRenewal(certificate.Leaf, authority, time.Now()))
+	assert.True(t, needsRenewal(certificate.Leaf, authority, time.Now().Add(2*time.Hour)))
+	assert.True(t, needsRenewal(certificate.Leaf, other, time.Now()), "Expected renewal after CA rotation")
+}
@@ -0,0 +1,143 @@
+package context
+
+import (
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const annotationPrefix = "git-clone-controller/"
+
+// MaxSpecNameLength keeps names of injected containers and volumes within 63 characters, "git-clone-controller-workspace-" is the longest prefix
+const MaxSpecNameLength = 32
+
+// perRepositoryAnnotations are never inherited by named checkout specifications from unprefixed annotations
+var perRepositoryAnnotations = []string{AnnotationGitUrl, AnnotationGitPath, AnnotationRev, AnnotationRepository}
+
+var specNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Annotations gives access to annotations of a single checkout specification.
+//
+// Pod can have multiple repositories cloned - each named specification e.g. "theme" is described with
+// indexed annotations like "git-clone-controller/theme.url". Shared settings like owner or secretName
+// are inherited from unprefixed annotations, when not defined for given specification
+type Annotations struct {
+	values     map[string]string
+	spec       string
+	repository map[string]string
+	defaults   map[string]string
+}
+
+// InheritedAnnotations are annotations defined outside the Pod, the Pod can override each of them
+type InheritedAnnotations struct {
+	// Repository are settings of a `kind: GitRepository` referenced by the Pod
+	Repository map[string]string
+	// Namespace are annotations of the Pod's Namespace
+	Namespace map[string]string
+}
+
+const (
+	// SourcePod, SourceRepository and SourceNamespace tell where an effective annotation value was defined
+	SourcePod        = "Pod"
+	SourceRepository = "GitRepository"
+	SourceNamespace  = "Namespace"
+)
+
+func ForSpec(values map[string]string, spec string) Annotations {
+	return Annotations{values: values, spec: spec}
+}
+
+// WithInherited falls back to settings of a referenced `kind: GitRepository`, then to annotations of the Pod's Namespace
+func (a Annotations) WithInherited(inherited InheritedAnnotations) Annotations {
+	a.repository = inherited.Repository
+	return a.WithNamespaceDefaults(inherited.Namespace)
+}
+
+// WithNamespaceDefaults falls back to annotations of the Pod's Namespace for shared settings like owner or secretName.
+// Pod annotations always take precedence, per-repository annotations (url, path, revision) are never taken from the Namespace
+func (a Annotations) WithNamespaceDefaults(defaults map[string]string) Annotations {
+	a.defaults = defaults
+	return a
+}
+
+// Name returns an annotation name for current specification e.g. "git-clone-controller/theme.url"
+func (a Annotations) Name(key string) string {
+	if a.spec == "" {
+		return key
+	}
+	return annotationPrefix + a.spec + "." + strings.TrimPrefix(key, annotationPrefix)
+}
+
+// Get returns annotation value for current specification, falls back to unprefixed annotation for shared settings
+func (a Annotations) Get(key string) string {
+	value, _ := a.Lookup(key)
+	return value
+}
+
+// Lookup returns annotation value and its source (SourcePod, SourceRepository or SourceNamespace), the source is empty when the value is not defined.
+// Annotations of the specification win over the `kind: GitRepository`, which wins over annotations shared by all repositories of the Pod and the Namespace
+func (a Annotations) Lookup(key string) (string, string) {
+	if val := a.values[a.Name(key)]; val != "" {
+		return val, SourcePod
+	}
+	if val := a.repository[key]; val != "" && key != AnnotationRepository {
+		return val, SourceRepository
+	}
+	for _, perRepository := range perRepositoryAnnotations {
+		if perRepository == key {
+			return "", ""
+		}
+	}
+	if val := a.values[key]; a.spec != "" && val != "" {
+		return val, SourcePod
+	}
+	if val := a.defaults[key]; val != "" {
+		return val, SourceNamespace
+	}
+	return "", ""
+}
+
+// FindCheckoutSpecs lists names of checkout specifications defined in annotations, a specification has an url or references a `kind: GitRepository`.
+// Empty name means unprefixed annotations e.g. "git-clone-controller/url"
+func FindCheckoutSpecs(annotations map[string]string) ([]string, error) {
+	var specs []string
+	_, hasUrl := annotations[AnnotationGitUrl]
+	_, hasRepository := annotations[AnnotationRepository]
+	if hasUrl || hasRepository {
+		specs = append(specs, "")
+	}
+
+	var named []string
+	seen := map[string]bool{}
+	for key := range annotations {
+		name, isSpec := specNameOf(key)
+		if !isSpec || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		// containers and volumes are named e.g. "git-clone-controller-workspace-{name}", which cannot be longer than 63 characters
+		if !specNameRegexp.MatchString(name) || len(name) > MaxSpecNameLength {
+			return nil, errors.Errorf("Invalid repository name '%s' in annotation '%s', only lowercase letters, digits and '-' are allowed (max. %d characters)", name, key, MaxSpecNameLength)
+		}
+		named = append(named, name)
+	}
+	sort.Strings(named)
+
+	return append(specs, named...), nil
+}
+
+// specNameOf extracts the name of a checkout specification from annotations like "git-clone-controller/theme.url" or "git-clone-controller/theme.repository"
+func specNameOf(key string) (string, bool) {
+	if !strings.HasPrefix(key, annotationPrefix) {
+		return "", false
+	}
+	for _, identifying := range []string{AnnotationGitUrl, AnnotationRepository} {
+		suffix := "." + strings.TrimPrefix(identifying, annotationPrefix)
+		if strings.HasSuffix(key, suffix) {
+			return strings.TrimSuffix(strings.TrimPrefix(key, annotationPrefix), suffix), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,151 @@
+package context_test
+
+import (
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"strings"
+	"testing"
+)
+
+func TestFindCheckoutSpecs(t *testing.T) {
+	specs, err := context.FindCheckoutSpecs(map[string]string{
+		"git-clone-controller/url":         "https://github.com/riotkit-org/wordpress",
+		"git-clone-controller/theme.url":   "https://github.com/riotkit-org/wordpress-theme",
+		"git-clone-controller/plugins.url": "https://github.com/riotkit-org/wordpress-plugins",
+		"git-clone-controller/theme.path":  "/var/www/riotkit/wp-content/themes/iwa",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"", "plugins", "theme"}, specs)
+}
+
+func TestFindCheckoutSpecs_InvalidName(t *testing.T) {
+	_, err := context.FindCheckoutSpecs(map[string]string{
+		"git-clone-controller/My_Theme.url": "https://github.com/riotkit-org/wordpress-theme",
+	})
+
+	assert.Contains(t, err.Error(), "Invalid repository name 'My_Theme'")
+}
+
+func TestFindCheckoutSpecs_NameTooLong(t *testing.T) {
+	_, err := context.FindCheckoutSpecs(map[string]string{
+		"git-clone-controller/" + strings.Repeat("a", 50) + ".url": "https://github.com/riotkit-org/wordpress-theme",
+	})
+	assert.Contains(t, err.Error(), "max. 32 characters")
+
+	specs, err := context.FindCheckoutSpecs(map[string]string{
+		"git-clone-controller/" + strings.Repeat("a", 32) + ".url": "https://github.com/riotkit-org/wordpress-theme",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{strings.Repeat("a", 32)}, specs)
+}
+
+func TestNewCheckoutParametersForSpec_InheritsSharedAnnotations(t *testing.T) {
+	pod := v1.Pod{}
+	pod.SetAnnotations(map[string]string{
+		"git-clone-controller/owner":       "1000",
+		"git-clone-controller/group":       "1000",
+		"git-clone-controller/revision":    "v1.0",
+		"git-clone-controller/theme.url":   "https://github.com/riotkit-org/wordpress-theme",
+		"git-clone-controller/theme.path":  "/var/www/riotkit/wp-content/themes/iwa",
+		"git-clone-controller/theme.group": "1001",
+	})
+
+	params, err := context.NewCheckoutParametersForSpec(&pod, "theme", context.InheritedAnnotations{}, "image", nil, context.SecretReference{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "theme", params.Name)
+	assert.Equal(t, "https://github.com/riotkit-org/wordpress-theme", params.GitUrl)
+	assert.Equal(t, "/var/www/riotkit/wp-content/themes/iwa", params.TargetPath)
+	assert.Equal(t, "1000", params.FilesOwner, "Expected to be inherited from unprefixed annotation")
+	assert.Equal(t, "1001", params.FilesGroup, "Expected to be taken from prefixed annotation")
+	assert.Equal(t, "main", params.GitRevision, "Revision is per-repository, should not be inherited")
+}
+
+func TestNewCheckoutParametersForSpec_MissingPathOfNamedSpec(t *testing.T) {
+	pod := v1.Pod{}
+	pod.SetAnnotations(map[string]string{
+		"git-clone-controller/owner":     "1000",
+		"git-clone-controller/group":     "1000",
+		"git-clone-controller/path":      "/workspace/source",
+		"git-clone-controller/theme.url": "https://github.com/riotkit-org/wordpress-theme",
+	})
+
+	_, err := context.NewCheckoutParametersForSpec(&pod, "theme", context.InheritedAnnotations{}, "image", nil, context.SecretReference{})
+
+	assert.Equal(t, "Annotation 'git-clone-controller/theme.path' not found in Pod, cannot guess destination directory", err.Error())
+}
+
+func TestAnnotations_LookupWithNamespaceDefaults(t *testing.T) {
+	annotations := context.ForSpec(map[string]string{
+		"git-clone-controller/owner":     "1000",
+		"git-clone-controller/theme.url": "https://github.com/riotkit-org/wordpress-theme",
+	}, "theme").WithNamespaceDefaults(map[string]string{
+		"git-clone-controller/owner":      "161",
+		"git-clone-controller/group":      "161",
+		"git-clone-controller/secretName": "git-iwa",
+		"git-clone-controller/url":        "https://github.com/riotkit-org/other",
+		"git-clone-controller/revision":   "v1.0",
+	})
+
+	value, source := annotations.Lookup(context.AnnotationFilesOwner)
+	assert.Equal(t, "1000", value, "Expected that Pod takes precedence over Namespace")
+	assert.Equal(t, context.SourcePod, source)
+
+	value, source = annotations.Lookup(context.AnnotationFilesGroup)
+	assert.Equal(t, "161", value)
+	assert.Equal(t, context.SourceNamespace, source)
+
+	value, source = annotations.Lookup(context.AnnotationGitUrl)
+	assert.Equal(t, "https://github.com/riotkit-org/wordpress-theme", value)
+	assert.Equal(t, context.SourcePod, source)
+
+	// url, path and revision describe a single repository, those are never shared by a whole Namespace
+	value, source = annotations.Lookup(context.AnnotationRev)
+	assert.Equal(t, "", value)
+	assert.Equal(t, "", source)
+}
+
+func TestFindCheckoutSpecs_ReferencingGitRepository(t *testing.T) {
+	specs, err := context.FindCheckoutSpecs(map[string]string{
+		"git-clone-controller/repository":       "wordpress",
+		"git-clone-controller/theme.repository": "my-theme",
+		"git-clone-controller/theme.url":        "https://github.com/riotkit-org/wordpress-theme",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"", "theme"}, specs)
+}
+
+func TestAnnotations_LookupWithGitRepository(t *testing.T) {
+	annotations := context.ForSpec(map[string]string{
+		"git-clone-controller/theme.repository": "my-theme",
+		"git-clone-controller/theme.revision":   "v2.0",
+		"git-clone-controller/secretName":       "shared-by-pod",
+	}, "theme").WithInherited(context.InheritedAnnotations{
+		Repository: map[string]string{
+			"git-clone-controller/url":        "https://github.com/riotkit-org/wordpress-theme",
+			"git-clone-controller/revision":   "v1.0",
+			"git-clone-controller/secretName": "theme-token",
+		},
+		Namespace: map[string]string{
+			"git-clone-controller/depth": "1",
+		},
+	})
+
+	value, source := annotations.Lookup(context.AnnotationGitUrl)
+	assert.Equal(t, "https://github.com/riotkit-org/wordpress-theme", value, "Expected that url is taken from GitRepository")
+	assert.Equal(t, context.SourceRepository, source)
+
+	value, source = annotations.Lookup(context.AnnotationRev)
+	assert.Equal(t, "v2.0", value, "Expected that Pod overrides GitRepository")
+	assert.Equal(t, context.SourcePod, source)
+
+	value, _ = annotations.Lookup(context.AnnotationSecretName)
+	assert.Equal(t, "theme-token", value, "Expected that GitRepository wins over annotations shared by all repositories of the Pod")
+
+	value, source = annotations.Lookup(context.AnnotationDepth)
+	assert.Equal(t, "1", value)
+	assert.Equal(t, context.SourceNamespace, source)
+}
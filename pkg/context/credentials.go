@@ -0,0 +1,73 @@
+package context
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Credentials are operator-wide GIT credentials of a single host, used for HTTPS basic auth
+type Credentials struct {
+	Username string
+	Token    string
+}
+
+// DefaultCredentials maps GIT hosts (e.g. "github.com", "git.example.org:8443") to operator-wide credentials.
+// Credentials are never sent to a host they were not configured for
+type DefaultCredentials map[string]Credentials
+
+// ParseDefaultCredentials reads entries of a `kind: Secret`, keyed by host. Values are "token" or "username:token"
+func ParseDefaultCredentials(data map[string][]byte) DefaultCredentials {
+	credentials := DefaultCredentials{}
+	for host, value := range data {
+		entry := strings.TrimSpace(string(value))
+		if entry == "" {
+			continue
+		}
+		// usernames cannot contain a colon in HTTP basic auth, tokens can
+		if username, token, found := strings.Cut(entry, ":"); found {
+			credentials[strings.ToLower(host)] = Credentials{Username: username, Token: token}
+			continue
+		}
+		credentials[strings.ToLower(host)] = Credentials{Token: entry}
+	}
+	return credentials
+}
+
+// ForUrl returns credentials of the repository's host. Host with port takes precedence over the host alone
+func (d DefaultCredentials) ForUrl(repositoryUrl string) Credentials {
+	return d[d.HostFor(repositoryUrl)]
+}
+
+// HostFor returns the configured host (key) matching the repository's url, empty when there are no credentials for it
+func (d DefaultCredentials) HostFor(repositoryUrl string) string {
+	host, port := hostOf(repositoryUrl)
+	if host == "" {
+		return ""
+	}
+	if port != "" {
+		if _, exists := d[host+":"+port]; exists {
+			return host + ":" + port
+		}
+	}
+	if _, exists := d[host]; exists {
+		return host
+	}
+	return ""
+}
+
+// hostOf extracts host and port from URL, including scp-like GIT-SSH syntax (git@github.com:riotkit-org/git-clone-controller.git)
+func hostOf(repositoryUrl string) (string, string) {
+	if strings.Contains(repositoryUrl, "://") {
+		parsed, err := url.Parse(repositoryUrl)
+		if err != nil {
+			return "", ""
+		}
+		return strings.ToLower(parsed.Hostname()), parsed.Port()
+	}
+	withoutUser := repositoryUrl[strings.LastIndex(repositoryUrl, "@")+1:]
+	host, _, found := strings.Cut(withoutUser, ":")
+	if !found {
+		return "", ""
+	}
+	return strings.ToLower(host), ""
+}
@@ -0,0 +1,42 @@
+package context_test
+
+import (
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseDefaultCredentials(t *testing.T) {
+	credentials := context.ParseDefaultCredentials(map[string][]byte{
+		"github.com":           []byte("ghp_solidarity"),
+		"git.internal.example": []byte("bakunin:glpat:with:colons\n"),
+		"empty.example":        []byte(""),
+	})
+
+	assert.Equal(t, context.DefaultCredentials{
+		"github.com":           {Token: "ghp_solidarity"},
+		"git.internal.example": {Username: "bakunin", Token: "glpat:with:colons"},
+	}, credentials)
+}
+
+func TestDefaultCredentials_ForUrl(t *testing.T) {
+	credentials := context.DefaultCredentials{
+		"github.com":                {Token: "github"},
+		"git.internal.example":      {Token: "internal"},
+		"git.internal.example:8443": {Token: "internal-8443"},
+	}
+
+	assert.Equal(t, "github", credentials.ForUrl("https://github.com/riotkit-org/git-clone-controller").Token)
+	assert.Equal(t, "github", credentials.ForUrl("https://GitHub.com/riotkit-org/git-clone-controller").Token)
+	assert.Equal(t, "github", credentials.ForUrl("git@github.com:riotkit-org/git-clone-controller.git").Token)
+	assert.Equal(t, "internal", credentials.ForUrl("https://user@git.internal.example/iwa/theme.git").Token)
+	assert.Equal(t, "internal-8443", credentials.ForUrl("https://git.internal.example:8443/iwa/theme.git").Token)
+
+	// tokens are never sent to other hosts, even if the name looks similar
+	assert.Equal(t, context.Credentials{}, credentials.ForUrl("https://github.com.attacker.example/riotkit-org/git-clone-controller"))
+	assert.Equal(t, context.Credentials{}, credentials.ForUrl("https://attacker.example/github.com"))
+	assert.Equal(t, context.Credentials{}, credentials.ForUrl("/local/path"))
+
+	assert.Equal(t, "git.internal.example:8443", credentials.HostFor("https://git.internal.example:8443/iwa/theme.git"))
+	assert.Equal(t, "", credentials.HostFor("https://attacker.example/github.com"))
+}
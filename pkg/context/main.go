@@ -11,4 +11,73 @@ const (
 	AnnotationSecretName     = "git-clone-controller/secretName"
 	AnnotationSecretTokenKey = "git-clone-controller/secretTokenKey"
 	AnnotationSecretUserKey  = "git-clone-controller/secretUsernameKey"
+
+	AnnotationMode         = "git-clone-controller/mode"
+	AnnotationSyncInterval = "git-clone-controller/syncInterval"
+	AnnotationSidecarType  = "git-clone-controller/sidecarType"
+
+	AnnotationSSHKeySecretKey     = "git-clone-controller/sshKeySecretKey"
+	AnnotationKnownHostsSecretKey = "git-clone-controller/knownHostsSecretKey"
+	// AnnotationSSHKeyPassphraseSecretKey is an entry of the same `kind: Secret` with passphrase of the SSH private key
+	AnnotationSSHKeyPassphraseSecretKey = "git-clone-controller/sshKeyPassphraseSecretKey"
+
+	AnnotationDepth        = "git-clone-controller/depth"
+	AnnotationSingleBranch = "git-clone-controller/singleBranch"
+	AnnotationNoTags       = "git-clone-controller/noTags"
+	AnnotationSparsePaths  = "git-clone-controller/sparsePaths"
+	AnnotationSubmodules   = "git-clone-controller/submodules"
+
+	AnnotationLFS        = "git-clone-controller/lfs"
+	AnnotationLFSInclude = "git-clone-controller/lfsInclude"
+	AnnotationLFSExclude = "git-clone-controller/lfsExclude"
+
+	AnnotationVerifyKeysConfigMap = "git-clone-controller/verifyKeysConfigMap"
+
+	// AnnotationChown runs the checkout as root and hands the files over to owner and group afterwards (e.g. NFS exports or hostPath),
+	// AnnotationChownGitDir includes `.git`, AnnotationChmod selects a ChmodPolicy
+	AnnotationChown       = "git-clone-controller/chown"
+	AnnotationChownGitDir = "git-clone-controller/chownGitDir"
+	AnnotationChmod       = "git-clone-controller/chmod"
+
+	// AnnotationRepository references a `kind: GitRepository` in the Pod's namespace, Pod annotations override its settings
+	AnnotationRepository = "git-clone-controller/repository"
+
+	AnnotationProvisionVolume           = "git-clone-controller/provisionVolume"
+	AnnotationProvisionVolumeContainers = "git-clone-controller/provisionVolumeContainers"
+
+	// AnnotationResolvedCommit is set by the controller, when the revision was pinned to a commit at admission time
+	AnnotationResolvedCommit = "git-clone-controller/resolvedCommit"
+
+	// AnnotationCheckedOutCommit and AnnotationCheckoutSummary are set by the controller, after the initContainer finished a checkout
+	AnnotationCheckedOutCommit = "git-clone-controller/checkedOutCommit"
+	AnnotationCheckoutSummary  = "git-clone-controller/checkoutSummary"
+
+	// AnnotationInjectedContainers and AnnotationInjectedVolumes are set by the controller on workload Pod templates
+	AnnotationInjectedContainers = "git-clone-controller/injectedContainers"
+	AnnotationInjectedVolumes    = "git-clone-controller/injectedVolumes"
+)
+
+const (
+	// ModeCheckout clones the repository once in an initContainer
+	ModeCheckout = "checkout"
+	// ModeSync keeps the repository updated by a sidecar container
+	ModeSync = "sync"
+
+	// SidecarTypeNative is an initContainer with `restartPolicy: Always`, requires Kubernetes 1.28+
+	SidecarTypeNative = "native"
+	// SidecarTypeContainer is a regular container running next to the application
+	SidecarTypeContainer = "container"
 )
+
+const (
+	// ChmodKeep leaves modes created by the checkout, other policies set permissions of directories and files,
+	// executable files get the execute bit wherever they are readable
+	ChmodKeep          = "keep"
+	ChmodPrivate       = "private"        // 0700 directories, 0600 files
+	ChmodGroupReadable = "group-readable" // 0750 directories, 0640 files
+	ChmodGroupWritable = "group-writable" // 0770 directories, 0660 files
+	ChmodWorldReadable = "world-readable" // 0755 directories, 0644 files
+)
+
+// ChmodPolicies lists valid values of AnnotationChmod and `checkout --chmod`
+var ChmodPolicies = []string{ChmodKeep, ChmodPrivate, ChmodGroupReadable, ChmodGroupWritable, ChmodWorldReadable}
@@ -0,0 +1,155 @@
+package context
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// AnnotationOpenShiftUIDRange and AnnotationOpenShiftSupplementalGroups are set by OpenShift on each Namespace,
+	// e.g. "1000650000/10000" - the restricted SCC runs containers with the first id of the range
+	AnnotationOpenShiftUIDRange           = "openshift.io/sa.scc.uid-range"
+	AnnotationOpenShiftSupplementalGroups = "openshift.io/sa.scc.supplemental-groups"
+
+	SourceContainerSecurityContext = "container securityContext"
+	SourcePodSecurityContext       = "Pod securityContext"
+	SourceOpenShift                = "OpenShift Namespace range"
+)
+
+// resolveFilesOwnership determines uid and gid of the cloned files. Precedence: Pod annotations, securityContext of the container
+// with the deepest mount of the target path, securityContext of the Pod, Namespace annotations, then the OpenShift range of the Namespace
+func resolveFilesOwnership(pod *corev1.Pod, annotations Annotations, targetPath string) (string, string, error) {
+	container := targetContainer(pod, targetPath)
+	var containerContext corev1.SecurityContext
+	if container != nil && container.SecurityContext != nil {
+		containerContext = *container.SecurityContext
+	}
+	var podContext corev1.PodSecurityContext
+	if pod.Spec.SecurityContext != nil {
+		podContext = *pod.Spec.SecurityContext
+	}
+	uidRange := annotations.defaults[AnnotationOpenShiftUIDRange]
+	groupsRange := annotations.defaults[AnnotationOpenShiftSupplementalGroups]
+	if groupsRange == "" {
+		groupsRange = uidRange
+	}
+
+	owner, ownerSource := firstDefined(annotations, AnnotationFilesOwner,
+		candidate{formatID(containerContext.RunAsUser), SourceContainerSecurityContext},
+		candidate{formatID(podContext.RunAsUser), SourcePodSecurityContext},
+		candidate{rangeStart(uidRange), SourceOpenShift},
+	)
+	if owner == "" {
+		return "", "", errors.Errorf("Annotation '%s' not found in Pod and no `runAsUser` in securityContext, files owner id must be specified", annotations.Name(AnnotationFilesOwner))
+	}
+	group, groupSource := firstDefined(annotations, AnnotationFilesGroup,
+		candidate{formatID(containerContext.RunAsGroup), SourceContainerSecurityContext},
+		candidate{formatID(podContext.RunAsGroup), SourcePodSecurityContext},
+		candidate{formatID(podContext.FSGroup), SourcePodSecurityContext},
+		candidate{rangeStart(groupsRange), SourceOpenShift},
+	)
+	if group == "" {
+		return "", "", errors.Errorf("Annotation '%s' not found in Pod and no `runAsGroup` or `fsGroup` in securityContext, files owner group id must be specified", annotations.Name(AnnotationFilesGroup))
+	}
+
+	logrus.Debugf("Pod '%s/%s': files owner '%s' taken from %s, group '%s' taken from %s", pod.Namespace, podName(pod), owner, ownerSource, group, groupSource)
+	return owner, group, nil
+}
+
+// candidate is a value derived from outside the annotations, together with its source
+type candidate struct {
+	value  string
+	source string
+}
+
+// firstDefined takes the annotation when defined in the Pod (or GitRepository), then the first derived value,
+// then the annotation of the Namespace. Settings of the Pod itself are more specific than defaults of a whole Namespace,
+// while the OpenShift range is the last resort
+func firstDefined(annotations Annotations, key string, derived ...candidate) (string, string) {
+	value, source := annotations.Lookup(key)
+	if value != "" && source != SourceNamespace {
+		return value, source
+	}
+	for _, c := range derived {
+		if c.source == SourceOpenShift && value != "" {
+			return value, source
+		}
+		if c.value != "" {
+			return c.value, c.source
+		}
+	}
+	return value, source
+}
+
+// targetContainer returns the container mounting the target path, the same as the volume of the clone is chosen: the deepest mount wins.
+// When no container mounts it (the volume is provisioned), then the first container of the Pod is used
+func targetContainer(pod *corev1.Pod, targetPath string) *corev1.Container {
+	_, mounts := DeepestMounts(pod.Spec.Containers, targetPath)
+	for _, mount := range mounts {
+		if !mount.Mount.ReadOnly {
+			return mount.Container
+		}
+	}
+	if len(mounts) > 0 {
+		return mounts[0].Container
+	}
+	if len(pod.Spec.Containers) > 0 {
+		return &pod.Spec.Containers[0]
+	}
+	return nil
+}
+
+// ContainerMount is a volume mount together with the container it belongs to
+type ContainerMount struct {
+	Container *corev1.Container
+	Mount     corev1.VolumeMount
+}
+
+// DeepestMounts returns the deepest mount path at (or above) the target path, and all mounts of containers at that path
+func DeepestMounts(containers []corev1.Container, targetPath string) (string, []ContainerMount) {
+	var deepest string
+	var mounts []ContainerMount
+	for i, container := range containers {
+		for _, volume := range container.VolumeMounts {
+			mountPath := path.Clean(volume.MountPath)
+			if !IsWithinPath(targetPath, mountPath) || len(mountPath) < len(deepest) {
+				continue
+			}
+			if len(mountPath) > len(deepest) {
+				deepest = mountPath
+				mounts = nil
+			}
+			mounts = append(mounts, ContainerMount{Container: &containers[i], Mount: volume})
+		}
+	}
+	return deepest, mounts
+}
+
+// IsWithinPath tells if path is the mount path itself or is placed inside it - `/var/www2` is not within `/var/www`
+func IsWithinPath(targetPath string, mountPath string) bool {
+	targetPath = path.Clean(targetPath)
+	mountPath = path.Clean(mountPath)
+	return mountPath == "/" || targetPath == mountPath || strings.HasPrefix(targetPath, mountPath+"/")
+}
+
+// formatID converts an optional id from securityContext
+func formatID(id *int64) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatInt(*id, 10)
+}
+
+// rangeStart returns the first id of an OpenShift range, which is "start/size" or "start-end"
+func rangeStart(value string) string {
+	start, _, _ := strings.Cut(strings.Split(value, ",")[0], "/")
+	start, _, _ = strings.Cut(start, "-")
+	if _, err := strconv.ParseInt(strings.TrimSpace(start), 10, 64); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(start)
+}
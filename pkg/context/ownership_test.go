@@ -0,0 +1,121 @@
+package context_test
+
+import (
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"testing"
+)
+
+func id(value int64) *int64 {
+	return &value
+}
+
+func podWithoutOwnership() v1.Pod {
+	pod := v1.Pod{}
+	pod.SetAnnotations(map[string]string{
+		"git-clone-controller/url":  "https://github.com/riotkit-org/wordpress-theme",
+		"git-clone-controller/path": "/var/www/html/wp-content/themes/iwa",
+	})
+	pod.Spec.Containers = []v1.Container{
+		{Name: "sidecar"},
+		{
+			Name:            "app",
+			VolumeMounts:    []v1.VolumeMount{{Name: "wp-content", MountPath: "/var/www/html/wp-content"}},
+			SecurityContext: &v1.SecurityContext{RunAsUser: id(33)},
+		},
+	}
+	pod.Spec.SecurityContext = &v1.PodSecurityContext{RunAsUser: id(65161), RunAsGroup: id(65162), FSGroup: id(65163)}
+	return pod
+}
+
+func TestNewCheckoutParametersFromPod_OwnershipFromSecurityContext(t *testing.T) {
+	pod := podWithoutOwnership()
+
+	params, err := context.NewCheckoutParametersFromPod(&pod, "image", nil, context.SecretReference{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "33", params.FilesOwner, "Expected that the container mounting the path takes precedence over the Pod")
+	assert.Equal(t, "65162", params.FilesGroup, "Expected that runAsGroup of the Pod is used, when the container does not define it")
+}
+
+func TestNewCheckoutParametersFromPod_OwnershipFromContainerWithDeepestMount(t *testing.T) {
+	pod := podWithoutOwnership()
+	pod.Spec.Containers[0].VolumeMounts = []v1.VolumeMount{{Name: "www", MountPath: "/var/www"}}
+	pod.Spec.Containers[0].SecurityContext = &v1.SecurityContext{RunAsUser: id(1000)}
+
+	params, err := context.NewCheckoutParametersFromPod(&pod, "image", nil, context.SecretReference{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "33", params.FilesOwner, "Expected that the container with the deepest mount is used, as the clone is placed on its volume")
+}
+
+func TestNewCheckoutParametersFromPod_OwnershipFromFSGroup(t *testing.T) {
+	pod := podWithoutOwnership()
+	pod.Spec.SecurityContext.RunAsGroup = nil
+
+	params, err := context.NewCheckoutParametersFromPod(&pod, "image", nil, context.SecretReference{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "65163", params.FilesGroup)
+}
+
+func TestNewCheckoutParametersFromPod_AnnotationsOverrideSecurityContext(t *testing.T) {
+	pod := podWithoutOwnership()
+	pod.Annotations["git-clone-controller/owner"] = "1000"
+	pod.Annotations["git-clone-controller/group"] = "1001"
+
+	params, err := context.NewCheckoutParametersFromPod(&pod, "image", nil, context.SecretReference{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1000", params.FilesOwner)
+	assert.Equal(t, "1001", params.FilesGroup)
+}
+
+func TestNewCheckoutParametersForSpec_OwnershipFromNamespace(t *testing.T) {
+	pod := podWithoutOwnership()
+	pod.Spec.Containers[1].SecurityContext = nil
+	pod.Spec.SecurityContext = &v1.PodSecurityContext{RunAsUser: id(65161)}
+
+	params, err := context.NewCheckoutParametersForSpec(&pod, "", context.InheritedAnnotations{Namespace: map[string]string{
+		"git-clone-controller/owner":    "161",
+		"git-clone-controller/group":    "161",
+		"openshift.io/sa.scc.uid-range": "1000650000/10000",
+	}}, "image", nil, context.SecretReference{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "65161", params.FilesOwner, "Expected that securityContext of the Pod wins over defaults of the Namespace")
+	assert.Equal(t, "161", params.FilesGroup, "Expected that Namespace annotation wins over OpenShift range")
+}
+
+func TestNewCheckoutParametersForSpec_OwnershipFromOpenShiftRange(t *testing.T) {
+	pod := podWithoutOwnership()
+	pod.Spec.Containers[1].SecurityContext = nil
+	pod.Spec.SecurityContext = nil
+
+	params, err := context.NewCheckoutParametersForSpec(&pod, "", context.InheritedAnnotations{Namespace: map[string]string{
+		"openshift.io/sa.scc.uid-range":           "1000650000/10000",
+		"openshift.io/sa.scc.supplemental-groups": "1000660000/10000",
+	}}, "image", nil, context.SecretReference{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1000650000", params.FilesOwner)
+	assert.Equal(t, "1000660000", params.FilesGroup)
+}
+
+func TestNewCheckoutParametersFromPod_OwnershipCannotBeDetermined(t *testing.T) {
+	pod := podWithoutOwnership()
+	pod.Spec.Containers[1].SecurityContext = nil
+	pod.Spec.SecurityContext = &v1.PodSecurityContext{RunAsUser: id(1000)}
+
+	_, err := context.NewCheckoutParametersFromPod(&pod, "image", nil, context.SecretReference{})
+
+	assert.Contains(t, err.Error(), "files owner group id must be specified")
+}
+
+func TestIsWithinPath(t *testing.T) {
+	assert.True(t, context.IsWithinPath("/var/www", "/var/www"))
+	assert.True(t, context.IsWithinPath("/var/www/html/", "/var/www"))
+	assert.True(t, context.IsWithinPath("/var/www", "/"))
+	assert.False(t, context.IsWithinPath("/var/www2", "/var/www"))
+}
@@ -2,54 +2,306 @@ package context
 
 import (
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Parameters struct {
-	GitUrl           string
-	GitUsername      string
+	// Name of the checkout specification, empty for unprefixed annotations
+	Name        string
+	GitUrl      string
+	GitUsername string
+	// GitToken is an operator-wide token of the repository's host, used only by the controller itself (revision pinning)
 	GitToken         string
 	GitRevision      string
+	Secret           SecretReference
 	FilesOwner       string
 	FilesGroup       string
 	TargetPath       string
 	Image            string
 	CleanUpWorkspace bool
+
+	Mode         string
+	SyncInterval string
+	SidecarType  string
+
+	// Depth limits the fetched history, 0 means full history
+	Depth        int
+	SingleBranch bool
+	NoTags       bool
+	// SparsePaths limits the worktree to selected directories
+	SparsePaths []string
+	Submodules  bool
+	// SubmodulesDepth limits nesting of submodules, 0 means the `checkout` command default
+	SubmodulesDepth int
+
+	// LFS enables download of Git LFS objects, optionally filtered with glob patterns
+	LFS        bool
+	LFSInclude []string
+	LFSExclude []string
+
+	// VerifyKeysConfigMap is a `kind: ConfigMap` with armored public keys, the checked out commit or tag must be signed by one of them
+	VerifyKeysConfigMap string
+
+	// ProvisionVolume adds an `emptyDir` at the target path, when no container mounts a volume there
+	ProvisionVolume           bool
+	ProvisionVolumeContainers []string
+
+	// Chown runs the checkout as root, then the worktree (and optionally `.git`) is handed over to FilesOwner and FilesGroup with ChmodPolicy applied
+	Chown       bool
+	ChownGitDir bool
+	ChmodPolicy string
+
+	// ResolvedCommit is the commit GitRevision pointed to at admission time, all replicas check out the same commit
+	ResolvedCommit string
+}
+
+// SecretReference points to entries of a `kind: Secret` placed in the Pod's namespace
+type SecretReference struct {
+	Name          string
+	TokenKey      string
+	UsernameKey   string
+	SSHKeyKey     string
+	KnownHostsKey string
+	// SSHKeyPassphraseKey is optional, used when the private key is encrypted
+	SSHKeyPassphraseKey string
 }
 
-func NewCheckoutParametersFromPod(pod *corev1.Pod, defaultImage string, defaultGitUsername string, defaultGitToken string, secretUsername string, secretGitToken string) (Parameters, error) {
-	if val, exists := pod.Annotations[AnnotationGitUrl]; !exists || val == "" {
-		return Parameters{}, errors.Errorf("Annotation '%s' not found in Pod, cannot recognize GIT url", AnnotationGitUrl)
+// IsDefined tells if the `kind: Secret` was referenced at all
+func (s SecretReference) IsDefined() bool {
+	return s.Name != "" && (s.TokenKey != "" || s.SSHKeyKey != "")
+}
+
+func NewCheckoutParametersFromPod(pod *corev1.Pod, defaultImage string, defaultCredentials DefaultCredentials, secret SecretReference) (Parameters, error) {
+	return NewCheckoutParametersForSpec(pod, "", InheritedAnnotations{}, defaultImage, defaultCredentials, secret)
+}
+
+// NewCheckoutParametersForSpec builds parameters for a named checkout specification (see FindCheckoutSpecs).
+// Values are taken with precedence: Pod annotations, then the referenced `kind: GitRepository`, then annotations of the Pod's Namespace,
+// then operator defaults. Operator-wide credentials are taken only for the host of the repository
+func NewCheckoutParametersForSpec(pod *corev1.Pod, spec string, inherited InheritedAnnotations, defaultImage string, defaultCredentials DefaultCredentials, secret SecretReference) (Parameters, error) {
+	annotations := ForSpec(pod.Annotations, spec).WithInherited(inherited)
+	logSources(pod, annotations)
+
+	if annotations.Get(AnnotationGitUrl) == "" {
+		return Parameters{}, errors.Errorf("Annotation '%s' not found in Pod, cannot recognize GIT url", annotations.Name(AnnotationGitUrl))
 	}
-	if val, exists := pod.Annotations[AnnotationGitPath]; !exists || val == "" {
-		return Parameters{}, errors.Errorf("Annotation '%s' not found in Pod, cannot guess destination directory", AnnotationGitPath)
+	if annotations.Get(AnnotationGitPath) == "" {
+		return Parameters{}, errors.Errorf("Annotation '%s' not found in Pod, cannot guess destination directory", annotations.Name(AnnotationGitPath))
 	}
-	if val, exists := pod.Annotations[AnnotationFilesOwner]; !exists || val == "" {
-		return Parameters{}, errors.Errorf("Annotation '%s' not found in Pod, files owner id must be specified", AnnotationFilesOwner)
+	owner, group, ownershipErr := resolveFilesOwnership(pod, annotations, annotations.Get(AnnotationGitPath))
+	if ownershipErr != nil {
+		return Parameters{}, ownershipErr
 	}
-	if val, exists := pod.Annotations[AnnotationFilesGroup]; !exists || val == "" {
-		return Parameters{}, errors.Errorf("Annotation '%s' not found in Pod, files owner group id must be specified", AnnotationFilesGroup)
+	revision := annotations.Get(AnnotationRev)
+	if revision == "" {
+		revision = "main"
 	}
-	if _, exists := pod.Annotations[AnnotationRev]; !exists {
-		pod.Annotations[AnnotationRev] = "main"
+	mode, syncInterval, sidecarType, syncErr := parseSyncAnnotations(annotations)
+	if syncErr != nil {
+		return Parameters{}, syncErr
 	}
-
-	if secretUsername == "" {
-		secretUsername = defaultGitUsername
+	depth := 0
+	if value := annotations.Get(AnnotationDepth); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return Parameters{}, errors.Errorf("Annotation '%s' has invalid value '%s', expected a non-negative number of commits", annotations.Name(AnnotationDepth), value)
+		}
+		depth = parsed
+	}
+	provisionVolume := isEnabled(annotations.Get(AnnotationProvisionVolume))
+	if provisionVolume && mode == ModeSync {
+		return Parameters{}, errors.Errorf("Annotation '%s' cannot be used in '%s' mode, the path is replaced with a symbolic link - mount a shared volume at a parent directory instead", annotations.Name(AnnotationProvisionVolume), ModeSync)
+	}
+	submodules, submodulesDepth, submodulesErr := parseSubmodulesAnnotation(annotations)
+	if submodulesErr != nil {
+		return Parameters{}, submodulesErr
 	}
-	if secretGitToken == "" {
-		secretGitToken = defaultGitToken
+	chown, chmodPolicy, chownErr := parseChownAnnotations(annotations, mode)
+	if chownErr != nil {
+		return Parameters{}, chownErr
 	}
+
+	credentials := defaultCredentials.ForUrl(annotations.Get(AnnotationGitUrl))
+	if credentials.Token != "" && !secret.IsDefined() {
+		logrus.Debugf("Pod '%s/%s': credentials for '%s' taken from operator defaults", pod.Namespace, podName(pod), annotations.Get(AnnotationGitUrl))
+	}
+
 	return Parameters{
-		Image:            defaultImage,
-		GitUrl:           pod.Annotations[AnnotationGitUrl],
-		GitRevision:      pod.Annotations[AnnotationRev],
-		GitUsername:      secretUsername,
-		GitToken:         secretGitToken,
-		TargetPath:       pod.Annotations[AnnotationGitPath],
-		FilesOwner:       pod.Annotations[AnnotationFilesOwner],
-		FilesGroup:       pod.Annotations[AnnotationFilesGroup],
-		CleanUpWorkspace: strings.ToLower(strings.Trim(pod.Annotations[AnnotationCleanUp], " ")) != "false",
-	}, nil
+		Name:                      spec,
+		Image:                     defaultImage,
+		GitUrl:                    annotations.Get(AnnotationGitUrl),
+		GitRevision:               revision,
+		GitUsername:               credentials.Username,
+		GitToken:                  credentials.Token,
+		TargetPath:                annotations.Get(AnnotationGitPath),
+		FilesOwner:                owner,
+		FilesGroup:                group,
+		CleanUpWorkspace:          strings.ToLower(strings.Trim(annotations.Get(AnnotationCleanUp), " ")) != "false",
+		Mode:                      mode,
+		SyncInterval:              syncInterval,
+		SidecarType:               sidecarType,
+		Depth:                     depth,
+		SingleBranch:              isEnabled(annotations.Get(AnnotationSingleBranch)),
+		NoTags:                    isEnabled(annotations.Get(AnnotationNoTags)),
+		SparsePaths:               parsePathList(annotations.Get(AnnotationSparsePaths)),
+		Submodules:                submodules,
+		SubmodulesDepth:           submodulesDepth,
+		LFS:                       isEnabled(annotations.Get(AnnotationLFS)),
+		LFSInclude:                parsePathList(annotations.Get(AnnotationLFSInclude)),
+		LFSExclude:                parsePathList(annotations.Get(AnnotationLFSExclude)),
+		VerifyKeysConfigMap:       annotations.Get(AnnotationVerifyKeysConfigMap),
+		ProvisionVolume:           provisionVolume,
+		ProvisionVolumeContainers: parseList(annotations.Get(AnnotationProvisionVolumeContainers)),
+		Chown:                     chown,
+		ChownGitDir:               chown && isEnabled(annotations.Get(AnnotationChownGitDir)),
+		ChmodPolicy:               chmodPolicy,
+	}.WithSecret(secret), nil
+}
+
+// sourcedAnnotations are logged with the level they were taken from, to explain how Pod and Namespace annotations were merged
+var sourcedAnnotations = []string{
+	AnnotationGitUrl, AnnotationGitPath, AnnotationRev, AnnotationFilesOwner, AnnotationFilesGroup, AnnotationCleanUp,
+	AnnotationSecretName, AnnotationSecretTokenKey, AnnotationSecretUserKey, AnnotationSSHKeySecretKey, AnnotationKnownHostsSecretKey,
+	AnnotationSSHKeyPassphraseSecretKey,
+	AnnotationMode, AnnotationSyncInterval, AnnotationSidecarType, AnnotationDepth, AnnotationSingleBranch, AnnotationNoTags,
+	AnnotationSparsePaths, AnnotationSubmodules, AnnotationLFS, AnnotationLFSInclude, AnnotationLFSExclude,
+	AnnotationVerifyKeysConfigMap, AnnotationProvisionVolume, AnnotationProvisionVolumeContainers,
+	AnnotationChown, AnnotationChownGitDir, AnnotationChmod,
+}
+
+// logSources logs at debug level, which level each effective value came from. Values not listed come from operator defaults
+func logSources(pod *corev1.Pod, annotations Annotations) {
+	if !logrus.IsLevelEnabled(logrus.DebugLevel) {
+		return
+	}
+	for _, key := range sourcedAnnotations {
+		if value, source := annotations.Lookup(key); source != "" {
+			logrus.Debugf("Pod '%s/%s': '%s' = '%s' taken from %s", pod.Namespace, podName(pod), annotations.Name(key), value, source)
+		}
+	}
+}
+
+// podName returns name of the Pod, or its prefix when the name is generated
+func podName(pod *corev1.Pod) string {
+	if pod.Name != "" {
+		return pod.Name
+	}
+	return pod.GenerateName
+}
+
+// parseSyncAnnotations validates the mode, in which the repository is cloned
+func parseSyncAnnotations(annotations Annotations) (string, string, string, error) {
+	mode := annotations.Get(AnnotationMode)
+	if mode == "" {
+		mode = ModeCheckout
+	}
+	if mode != ModeCheckout && mode != ModeSync {
+		return "", "", "", errors.Errorf("Annotation '%s' has invalid value '%s', expected '%s' or '%s'", annotations.Name(AnnotationMode), mode, ModeCheckout, ModeSync)
+	}
+
+	interval := annotations.Get(AnnotationSyncInterval)
+	if interval == "" {
+		interval = "1m"
+	}
+	if _, err := time.ParseDuration(interval); err != nil {
+		return "", "", "", errors.Errorf("Annotation '%s' has invalid value '%s', expected duration e.g. 30s, 5m", annotations.Name(AnnotationSyncInterval), interval)
+	}
+
+	sidecarType := annotations.Get(AnnotationSidecarType)
+	if sidecarType == "" {
+		sidecarType = SidecarTypeNative
+	}
+	if sidecarType != SidecarTypeNative && sidecarType != SidecarTypeContainer {
+		return "", "", "", errors.Errorf("Annotation '%s' has invalid value '%s', expected '%s' or '%s'", annotations.Name(AnnotationSidecarType), sidecarType, SidecarTypeNative, SidecarTypeContainer)
+	}
+
+	return mode, interval, sidecarType, nil
+}
+
+// parseSubmodulesAnnotation accepts "true", "false" or a maximum depth of nested submodules
+func parseSubmodulesAnnotation(annotations Annotations) (bool, int, error) {
+	value := strings.ToLower(strings.TrimSpace(annotations.Get(AnnotationSubmodules)))
+	if value == "" || value == "false" {
+		return false, 0, nil
+	}
+	if value == "true" {
+		return true, 0, nil
+	}
+	depth, err := strconv.Atoi(value)
+	if err != nil || depth < 1 {
+		return false, 0, errors.Errorf("Annotation '%s' has invalid value '%s', expected 'true', 'false' or maximum depth of nested submodules", annotations.Name(AnnotationSubmodules), value)
+	}
+	return true, depth, nil
+}
+
+// parseChownAnnotations validates the chown mode. A sync sidecar runs as long as the Pod, so it is never granted root
+func parseChownAnnotations(annotations Annotations, mode string) (bool, string, error) {
+	chown := isEnabled(annotations.Get(AnnotationChown))
+	if chown && mode == ModeSync {
+		return false, "", errors.Errorf("Annotation '%s' cannot be used in '%s' mode, the sidecar would run as root for the whole life of the Pod", annotations.Name(AnnotationChown), ModeSync)
+	}
+
+	policy := strings.TrimSpace(annotations.Get(AnnotationChmod))
+	if policy == "" {
+		return chown, ChmodKeep, nil
+	}
+	if !chown {
+		return false, "", errors.Errorf("Annotation '%s' is applied only together with '%s: \"true\"'", annotations.Name(AnnotationChmod), annotations.Name(AnnotationChown))
+	}
+	for _, known := range ChmodPolicies {
+		if policy == known {
+			return chown, policy, nil
+		}
+	}
+	return false, "", errors.Errorf("Annotation '%s' has invalid value '%s', expected one of: %s", annotations.Name(AnnotationChmod), policy, strings.Join(ChmodPolicies, ", "))
+}
+
+// parsePathList splits a comma-separated list of paths (or patterns) relative to the repository root
+func parsePathList(value string) []string {
+	var paths []string
+	for _, path := range parseList(value) {
+		if path = strings.Trim(path, "/"); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// parseList splits a comma-separated list, skipping empty values
+func parseList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// isEnabled tells if a boolean annotation is set to "true"
+func isEnabled(value string) bool {
+	return strings.ToLower(strings.Trim(value, " ")) == "true"
+}
+
+// TokenUsername is the basic auth username sent together with a token, when the username is not specified
+const TokenUsername = "__token__"
+
+// WithSecret switches credentials to given `kind: Secret`.
+// Operator defaults are used only, when the Pod does not reference any `kind: Secret` - also the default username
+// is not mixed with a token of the Secret
+func (p Parameters) WithSecret(secret SecretReference) Parameters {
+	if !secret.IsDefined() {
+		return p
+	}
+	p.Secret = secret
+	p.GitToken = ""
+	p.GitUsername = TokenUsername
+	if secret.UsernameKey != "" {
+		p.GitUsername = ""
+	}
+	return p
 }
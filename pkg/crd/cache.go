@@ -0,0 +1,122 @@
+package crd
+
+import (
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"time"
+)
+
+// Cache keeps custom resources in memory using informers
+type Cache struct {
+	factory dynamicinformer.DynamicSharedInformerFactory
+	listers map[schema.GroupVersionResource]cache.GenericLister
+}
+
+// NewCache creates a cache of given resources e.g. GitClonePermissionsResource, GitRepositoryResource.
+// Only those resources are watched, so their CRDs must be installed
+func NewCache(client dynamic.Interface, resync time.Duration, resources ...schema.GroupVersionResource) *Cache {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, resync)
+
+	listers := make(map[schema.GroupVersionResource]cache.GenericLister, len(resources))
+	for _, resource := range resources {
+		listers[resource] = factory.ForResource(resource).Lister()
+	}
+	return &Cache{
+		factory: factory,
+		listers: listers,
+	}
+}
+
+// lister returns a lister of a watched resource
+func (c *Cache) lister(resource schema.GroupVersionResource) (cache.GenericLister, error) {
+	lister, watched := c.listers[resource]
+	if !watched {
+		return nil, errors.Errorf("%s are not watched by git-clone-controller", resource.Resource)
+	}
+	return lister, nil
+}
+
+// Start begins watching resources in background
+func (c *Cache) Start(stopCh <-chan struct{}) {
+	c.factory.Start(stopCh)
+}
+
+// WaitForCacheSync blocks until all resources are initially loaded
+func (c *Cache) WaitForCacheSync(stopCh <-chan struct{}) bool {
+	for _, synced := range c.factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			return false
+		}
+	}
+	return true
+}
+
+// ListPermissions returns all GitClonePermissions from given namespace
+func (c *Cache) ListPermissions(namespace string) ([]GitClonePermissions, error) {
+	lister, listerErr := c.lister(GitClonePermissionsResource)
+	if listerErr != nil {
+		return nil, listerErr
+	}
+	objects, err := lister.ByNamespace(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot list GitClonePermissions in namespace '%s'", namespace)
+	}
+
+	permissions := make([]GitClonePermissions, 0, len(objects))
+	for _, object := range objects {
+		var permission GitClonePermissions
+		if err := fromUnstructured(object, &permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, nil
+}
+
+// AuthorizeRepository finds GitClonePermissions that allows to clone given revision of a repository in a namespace
+func (c *Cache) AuthorizeRepository(namespace string, url string, revision string) (*GitClonePermissions, error) {
+	permissions, err := c.ListPermissions(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return FindMatchingPermissions(permissions, namespace, url, revision)
+}
+
+// GetRepository returns a GitRepository from given namespace
+func (c *Cache) GetRepository(namespace string, name string) (*GitRepository, error) {
+	lister, listerErr := c.lister(GitRepositoryResource)
+	if listerErr != nil {
+		return nil, listerErr
+	}
+	object, err := lister.ByNamespace(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil, errors.Errorf("GitRepository '%s' not found in namespace '%s'", name, namespace)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot get GitRepository '%s/%s'", namespace, name)
+	}
+
+	var repository GitRepository
+	if err := fromUnstructured(object, &repository); err != nil {
+		return nil, err
+	}
+	return &repository, nil
+}
+
+func fromUnstructured(object runtime.Object, target interface{}) error {
+	u, ok := object.(*unstructured.Unstructured)
+	if !ok {
+		return errors.Errorf("unexpected object type %T in cache", object)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), target); err != nil {
+		return errors.Wrapf(err, "Cannot parse %s '%s/%s'", u.GetKind(), u.GetNamespace(), u.GetName())
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package crd_test
+
+import (
+	"context"
+	"github.com/riotkit-org/git-clone-controller/pkg/crd"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	"testing"
+)
+
+func TestCache_AuthorizeRepository(t *testing.T) {
+	permission := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "riotkit.org/v1alpha1",
+		"kind":       "GitClonePermissions",
+		"metadata":   map[string]interface{}{"name": "themes", "namespace": "anarchism"},
+		"spec": map[string]interface{}{
+			"allowedUrls": []interface{}{"https://git.example.org/themes/*"},
+			"secretRef":   map[string]interface{}{"name": "themes-token", "tokenKey": "token"},
+		},
+	}}
+	client := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		crd.GitClonePermissionsResource: "GitClonePermissionsList",
+	})
+	// notice: created explicitly, as the resource name cannot be guessed from "GitClonePermissions" kind
+	_, createErr := client.Resource(crd.GitClonePermissionsResource).Namespace("anarchism").Create(context.TODO(), permission, metav1.CreateOptions{})
+	assert.Nil(t, createErr)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	cache := crd.NewCache(client, 0, crd.GitClonePermissionsResource)
+	cache.Start(stop)
+	assert.True(t, cache.WaitForCacheSync(stop))
+
+	matched, err := cache.AuthorizeRepository("anarchism", "https://git.example.org/themes/iwa", "main")
+	assert.Nil(t, err)
+	assert.Equal(t, "themes-token", matched.Spec.SecretRef.Name)
+
+	// other namespace has no permissions at all
+	_, deniedErr := cache.AuthorizeRepository("capitalism", "https://git.example.org/themes/iwa", "main")
+	assert.NotNil(t, deniedErr)
+}
+
+func TestCache_GetRepository(t *testing.T) {
+	repository := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "riotkit.org/v1alpha1",
+		"kind":       "GitRepository",
+		"metadata":   map[string]interface{}{"name": "my-theme", "namespace": "anarchism"},
+		"spec": map[string]interface{}{
+			"url":       "https://git.example.org/themes/iwa",
+			"revision":  "v1.0",
+			"depth":     int64(1),
+			"secretRef": map[string]interface{}{"name": "themes-token", "tokenKey": "token"},
+		},
+	}}
+	client := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		crd.GitRepositoryResource: "GitRepositoryList",
+	})
+	_, createErr := client.Resource(crd.GitRepositoryResource).Namespace("anarchism").Create(context.TODO(), repository, metav1.CreateOptions{})
+	assert.Nil(t, createErr)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	cache := crd.NewCache(client, 0, crd.GitRepositoryResource)
+	cache.Start(stop)
+	assert.True(t, cache.WaitForCacheSync(stop))
+
+	found, err := cache.GetRepository("anarchism", "my-theme")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"git-clone-controller/url":            "https://git.example.org/themes/iwa",
+		"git-clone-controller/revision":       "v1.0",
+		"git-clone-controller/depth":          "1",
+		"git-clone-controller/secretName":     "themes-token",
+		"git-clone-controller/secretTokenKey": "token",
+	}, found.Spec.ToAnnotations())
+
+	_, notFoundErr := cache.GetRepository("capitalism", "my-theme")
+	assert.Equal(t, "GitRepository 'my-theme' not found in namespace 'capitalism'", notFoundErr.Error())
+
+	// GitClonePermissions were not requested to be watched
+	_, notWatchedErr := cache.ListPermissions("anarchism")
+	assert.NotNil(t, notWatchedErr)
+}
@@ -0,0 +1,57 @@
+package crd
+
+import (
+	"github.com/pkg/errors"
+	"path"
+	"strings"
+)
+
+// AllowsUrl checks if repository url matches any of allowed patterns. Trailing ".git" suffix is not relevant
+func (p *GitClonePermissions) AllowsUrl(url string) bool {
+	for _, pattern := range p.Spec.AllowedUrls {
+		if matchesPattern(pattern, url) || matchesPattern(strings.TrimSuffix(pattern, ".git"), strings.TrimSuffix(url, ".git")) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRevision checks if revision (branch, tag or commit) matches any of allowed patterns
+func (p *GitClonePermissions) AllowsRevision(revision string) bool {
+	if len(p.Spec.AllowedRevisions) == 0 {
+		return true
+	}
+	for _, pattern := range p.Spec.AllowedRevisions {
+		if matchesPattern(pattern, revision) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindMatchingPermissions looks for a GitClonePermissions that allows to clone given revision of given repository
+func FindMatchingPermissions(permissions []GitClonePermissions, namespace string, url string, revision string) (*GitClonePermissions, error) {
+	var deniedRevisionBy []string
+
+	for i := range permissions {
+		if !permissions[i].AllowsUrl(url) {
+			continue
+		}
+		if !permissions[i].AllowsRevision(revision) {
+			deniedRevisionBy = append(deniedRevisionBy, permissions[i].Name)
+			continue
+		}
+		return &permissions[i], nil
+	}
+
+	if len(deniedRevisionBy) > 0 {
+		return nil, errors.Errorf("revision '%s' of repository '%s' is not allowed by GitClonePermissions: %s", revision, url, strings.Join(deniedRevisionBy, ", "))
+	}
+	return nil, errors.Errorf("repository '%s' is not allowed in namespace '%s' by any GitClonePermissions", url, namespace)
+}
+
+// matchesPattern uses shell file name patterns, where "*" does not match "/"
+func matchesPattern(pattern string, value string) bool {
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
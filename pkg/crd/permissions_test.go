@@ -0,0 +1,61 @@
+package crd_test
+
+import (
+	"github.com/riotkit-org/git-clone-controller/pkg/crd"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func TestGitClonePermissions_AllowsUrl(t *testing.T) {
+	p := crd.GitClonePermissions{Spec: crd.GitClonePermissionsSpec{
+		AllowedUrls: []string{"https://github.com/riotkit-org/*", "git@git.example.org:themes/iwa.git"},
+	}}
+
+	assert.True(t, p.AllowsUrl("https://github.com/riotkit-org/git-clone-controller"))
+	assert.True(t, p.AllowsUrl("https://github.com/riotkit-org/git-clone-controller.git"))
+	assert.True(t, p.AllowsUrl("git@git.example.org:themes/iwa"))
+	assert.False(t, p.AllowsUrl("https://github.com/other-org/git-clone-controller"))
+	assert.False(t, p.AllowsUrl("https://github.com/riotkit-org/nested/repository"))
+}
+
+func TestGitClonePermissions_AllowsRevision(t *testing.T) {
+	p := crd.GitClonePermissions{Spec: crd.GitClonePermissionsSpec{AllowedRevisions: []string{"main", "v*"}}}
+
+	assert.True(t, p.AllowsRevision("main"))
+	assert.True(t, p.AllowsRevision("v1.0.2"))
+	assert.False(t, p.AllowsRevision("feature-branch"))
+
+	anyRevision := crd.GitClonePermissions{}
+	assert.True(t, anyRevision.AllowsRevision("feature-branch"))
+}
+
+func TestFindMatchingPermissions(t *testing.T) {
+	permissions := []crd.GitClonePermissions{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "releases-only"},
+			Spec: crd.GitClonePermissionsSpec{
+				AllowedUrls:      []string{"https://github.com/riotkit-org/*"},
+				AllowedRevisions: []string{"v*"},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "themes"},
+			Spec: crd.GitClonePermissionsSpec{
+				AllowedUrls: []string{"https://git.example.org/themes/*"},
+				SecretRef:   &crd.SecretReference{Name: "themes-token", TokenKey: "token"},
+			},
+		},
+	}
+
+	matched, err := crd.FindMatchingPermissions(permissions, "anarchism", "https://git.example.org/themes/iwa", "main")
+	assert.Nil(t, err)
+	assert.Equal(t, "themes", matched.Name)
+	assert.Equal(t, "themes-token", matched.Spec.SecretRef.ToParameters().Name)
+
+	_, revisionErr := crd.FindMatchingPermissions(permissions, "anarchism", "https://github.com/riotkit-org/git-clone-controller", "main")
+	assert.Equal(t, "revision 'main' of repository 'https://github.com/riotkit-org/git-clone-controller' is not allowed by GitClonePermissions: releases-only", revisionErr.Error())
+
+	_, urlErr := crd.FindMatchingPermissions(permissions, "anarchism", "https://github.com/other-org/repository", "main")
+	assert.Equal(t, "repository 'https://github.com/other-org/repository' is not allowed in namespace 'anarchism' by any GitClonePermissions", urlErr.Error())
+}
@@ -0,0 +1,144 @@
+// Package crd contains custom resources understood by git-clone-controller,
+// together with a cache that keeps them in memory, so the admission webhook does not need to query the API on each request
+package crd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group   = "riotkit.org"
+	Version = "v1alpha1"
+)
+
+var (
+	GitClonePermissionsResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "gitclonepermissions"}
+	GitRepositoryResource       = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "gitrepositories"}
+)
+
+// GitClonePermissions specifies which GIT repositories and revisions are allowed to be cloned in a namespace
+type GitClonePermissions struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec GitClonePermissionsSpec `json:"spec"`
+}
+
+type GitClonePermissionsSpec struct {
+	// AllowedUrls is a list of patterns e.g. "https://github.com/riotkit-org/*"
+	AllowedUrls []string `json:"allowedUrls"`
+
+	// AllowedRevisions is a list of patterns e.g. "main", "v*". Empty list means that any revision is allowed
+	AllowedRevisions []string `json:"allowedRevisions,omitempty"`
+
+	// SecretRef points to credentials used, when the Pod does not specify its own `kind: Secret`
+	SecretRef *SecretReference `json:"secretRef,omitempty"`
+}
+
+// GitRepository describes a GIT repository once, Pods reference it with `git-clone-controller/repository` annotation
+type GitRepository struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec GitRepositorySpec `json:"spec"`
+}
+
+type GitRepositorySpec struct {
+	Url      string `json:"url"`
+	Revision string `json:"revision,omitempty"`
+
+	// SecretRef points to credentials in the namespace of the GitRepository
+	SecretRef *SecretReference `json:"secretRef,omitempty"`
+
+	Depth        int      `json:"depth,omitempty"`
+	SingleBranch bool     `json:"singleBranch,omitempty"`
+	NoTags       bool     `json:"noTags,omitempty"`
+	SparsePaths  []string `json:"sparsePaths,omitempty"`
+
+	// Submodules are initialized recursively, SubmodulesDepth limits the recursion (0 means the `checkout` command default)
+	Submodules      bool `json:"submodules,omitempty"`
+	SubmodulesDepth int  `json:"submodulesDepth,omitempty"`
+
+	LFS        bool     `json:"lfs,omitempty"`
+	LFSInclude []string `json:"lfsInclude,omitempty"`
+	LFSExclude []string `json:"lfsExclude,omitempty"`
+
+	VerifyKeysConfigMap string `json:"verifyKeysConfigMap,omitempty"`
+}
+
+// ToAnnotations converts the specification into unprefixed-name annotations e.g. "git-clone-controller/url",
+// so the Pod annotations can override each setting. Unset fields are omitted
+func (s GitRepositorySpec) ToAnnotations() map[string]string {
+	annotations := map[string]string{
+		context.AnnotationGitUrl:              s.Url,
+		context.AnnotationRev:                 s.Revision,
+		context.AnnotationSparsePaths:         strings.Join(s.SparsePaths, ","),
+		context.AnnotationLFSInclude:          strings.Join(s.LFSInclude, ","),
+		context.AnnotationLFSExclude:          strings.Join(s.LFSExclude, ","),
+		context.AnnotationVerifyKeysConfigMap: s.VerifyKeysConfigMap,
+	}
+	if s.SecretRef != nil {
+		annotations[context.AnnotationSecretName] = s.SecretRef.Name
+		annotations[context.AnnotationSecretTokenKey] = s.SecretRef.TokenKey
+		annotations[context.AnnotationSecretUserKey] = s.SecretRef.UsernameKey
+		annotations[context.AnnotationSSHKeySecretKey] = s.SecretRef.SSHKeyKey
+		annotations[context.AnnotationKnownHostsSecretKey] = s.SecretRef.KnownHostsKey
+		annotations[context.AnnotationSSHKeyPassphraseSecretKey] = s.SecretRef.SSHKeyPassphraseKey
+	}
+	if s.Depth > 0 {
+		annotations[context.AnnotationDepth] = strconv.Itoa(s.Depth)
+	}
+	if s.SingleBranch {
+		annotations[context.AnnotationSingleBranch] = "true"
+	}
+	if s.NoTags {
+		annotations[context.AnnotationNoTags] = "true"
+	}
+	if s.Submodules {
+		annotations[context.AnnotationSubmodules] = "true"
+		if s.SubmodulesDepth > 0 {
+			annotations[context.AnnotationSubmodules] = strconv.Itoa(s.SubmodulesDepth)
+		}
+	}
+	if s.LFS {
+		annotations[context.AnnotationLFS] = "true"
+	}
+	for key, value := range annotations {
+		if value == "" {
+			delete(annotations, key)
+		}
+	}
+	return annotations
+}
+
+// SecretReference points to entries of a `kind: Secret` placed in same namespace
+type SecretReference struct {
+	Name          string `json:"name"`
+	TokenKey      string `json:"tokenKey,omitempty"`
+	UsernameKey   string `json:"usernameKey,omitempty"`
+	SSHKeyKey     string `json:"sshKeyKey,omitempty"`
+	KnownHostsKey string `json:"knownHostsKey,omitempty"`
+	// SSHKeyPassphraseKey is an entry with passphrase of an encrypted SSH private key
+	SSHKeyPassphraseKey string `json:"sshKeyPassphraseKey,omitempty"`
+}
+
+// ToParameters converts to a reference used to build the initContainer
+func (s *SecretReference) ToParameters() context.SecretReference {
+	if s == nil {
+		return context.SecretReference{}
+	}
+	return context.SecretReference{
+		Name:          s.Name,
+		TokenKey:      s.TokenKey,
+		UsernameKey:   s.UsernameKey,
+		SSHKeyKey:     s.SSHKeyKey,
+		KnownHostsKey: s.KnownHostsKey,
+
+		SSHKeyPassphraseKey: s.SSHKeyPassphraseKey,
+	}
+}
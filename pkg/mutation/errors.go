@@ -0,0 +1,10 @@
+package mutation
+
+// RejectionError means the Pod cannot be mutated as specified in its annotations, the admission should be denied with given reason
+type RejectionError struct {
+	Reason string
+}
+
+func (e RejectionError) Error() string {
+	return e.Reason
+}
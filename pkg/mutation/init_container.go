@@ -1,6 +1,7 @@
 package mutation
 
 import (
+	"fmt"
 	appCtx "github.com/riotkit-org/git-clone-controller/pkg/context"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
@@ -8,52 +9,198 @@ import (
 	"strings"
 )
 
-const InitContainerName = "git-checkout"
+const (
+	InitContainerName = "git-checkout"
+	SyncContainerName = "git-sync"
+	SSHVolumeName     = "git-clone-controller-ssh"
+	SSHMountPath      = "/etc/git-clone-controller/ssh"
+	KeysVolumeName    = "git-clone-controller-keys"
+	KeysMountPath     = "/etc/git-clone-controller/keys"
+	WorkspaceVolume   = "git-clone-controller-workspace"
+)
 
-// MutatePodByInjectingInitContainer returns a new mutated pod according to set env rules
-func MutatePodByInjectingInitContainer(pod *corev1.Pod, logger logrus.FieldLogger, params appCtx.Parameters) (*corev1.Pod, error) {
+// MutatePodByInjectingInitContainer returns a new mutated pod according to set env rules.
+// Each checkout specification results in a separate, uniquely named initContainer
+func MutatePodByInjectingInitContainer(pod *corev1.Pod, logger logrus.FieldLogger, params ...appCtx.Parameters) (*corev1.Pod, error) {
 	nLogger := logger.WithField("mutation", "Mutating pod")
 	mutatedPod := pod.DeepCopy()
 
-	if hasGitInitContainer(pod) {
-		nLogger.Infof("ResolvePod '%s' already has initContainer present", pod.ObjectMeta.Name)
-		return mutatedPod, nil
-	}
+	for _, spec := range params {
+		if hasGitInitContainer(pod, ContainerName(spec)) {
+			nLogger.Infof("ResolvePod '%s' already has initContainer '%s' present", pod.ObjectMeta.Name, ContainerName(spec))
+			continue
+		}
 
-	injectInitContainer(mutatedPod, params.Image, params.TargetPath, params.GitRevision, params.GitUrl, params.GitToken, params.GitUsername, params.FilesOwner, params.FilesGroup, params.CleanUpWorkspace)
+		if spec.Mode == appCtx.ModeSync {
+			if err := injectSyncContainer(mutatedPod, spec); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := injectInitContainer(mutatedPod, spec); err != nil {
+			return nil, err
+		}
+	}
 	return mutatedPod, nil
 }
 
+// ContainerName returns name of the initContainer for given checkout specification e.g. "git-checkout-theme"
+func ContainerName(params appCtx.Parameters) string {
+	if params.Mode == appCtx.ModeSync {
+		return withSpecSuffix(SyncContainerName, params.Name)
+	}
+	return withSpecSuffix(InitContainerName, params.Name)
+}
+
+// IsInjected tells if the Pod already has the checkout or sync container of given checkout specification,
+// e.g. when the Pod was created from an already mutated template
+func IsInjected(pod *corev1.Pod, spec string) bool {
+	return hasGitInitContainer(pod, withSpecSuffix(InitContainerName, spec)) || hasGitInitContainer(pod, withSpecSuffix(SyncContainerName, spec))
+}
+
+func withSpecSuffix(name string, spec string) string {
+	if spec == "" {
+		return name
+	}
+	return name + "-" + spec
+}
+
 // injectInitContainer injects an initContainer
-func injectInitContainer(pod *corev1.Pod, image string, path string, rev string, gitUrl string, gitToken string,
-	userName string, owner string, group string, cleanUpWorkspace bool) {
+func injectInitContainer(pod *corev1.Pod, params appCtx.Parameters) error {
+	container, err := createGitContainer(pod, params, "checkout")
+	if err != nil {
+		return err
+	}
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, container)
+
+	if params.ResolvedCommit != "" {
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[appCtx.ForSpec(pod.Annotations, params.Name).Name(appCtx.AnnotationResolvedCommit)] = params.ResolvedCommit
+	}
+	return nil
+}
+
+// createGitContainer creates a container running given `git-clone-controller` subcommand ("checkout" or "sync")
+func createGitContainer(pod *corev1.Pod, params appCtx.Parameters, subcommand string) (corev1.Container, error) {
+	owner := params.FilesOwner
+	group := params.FilesGroup
+
+	// without a shared volume the clone would land in the initContainer's own filesystem and would be lost
+	workspaceMounts, workspaceEnv, planErr := planVolumeMounts(pod.Spec.Containers, params.TargetPath)
+	if planErr != nil {
+		return corev1.Container{}, planErr
+	}
+	if len(workspaceMounts) == 0 {
+		if !params.ProvisionVolume {
+			return corev1.Container{}, RejectionError{Reason: fmt.Sprintf("no container mounts a volume containing path '%s', the cloned files would be lost. "+
+				"Mount a shared volume or set annotation '%s: \"true\"'", params.TargetPath, appCtx.AnnotationProvisionVolume)}
+		}
+		provisioned, provisionErr := provisionVolume(pod, params)
+		if provisionErr != nil {
+			return corev1.Container{}, provisionErr
+		}
+		workspaceMounts = provisioned
+	}
 
 	args := []string{
-		"checkout",
-		gitUrl,
-		"--path", path,
-		"--rev", rev,
-		"--token", gitToken,
-		"--username", userName,
-		"--clean-remotes",
+		subcommand,
+		params.GitUrl,
+		"--path", params.TargetPath,
+		"--rev", params.GitRevision,
+	}
+	if params.ResolvedCommit != "" {
+		args = append(args, "--commit", params.ResolvedCommit)
+	}
+
+	// username is not a secret, when it comes from operator defaults it can be passed directly
+	if params.GitUsername != "" {
+		args = append(args, "--username", params.GitUsername)
+	}
+
+	// SSH private key and known_hosts are mounted from the `kind: Secret` as files
+	var extraMounts []corev1.VolumeMount
+	if params.Secret.IsDefined() && params.Secret.SSHKeyKey != "" {
+		extraMounts = injectSSHVolume(pod, params)
+		args = append(args, "--ssh-key-path", SSHMountPath+"/identity")
+		if params.Secret.KnownHostsKey != "" {
+			args = append(args, "--known-hosts-path", SSHMountPath+"/known_hosts")
+		}
 	}
 
-	if cleanUpWorkspace {
+	if params.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(params.Depth))
+	}
+	if params.SingleBranch {
+		args = append(args, "--single-branch")
+	}
+	if params.NoTags {
+		args = append(args, "--no-tags")
+	}
+	if params.Submodules {
+		args = append(args, "--recurse-submodules")
+		if params.SubmodulesDepth > 0 {
+			args = append(args, "--submodules-depth", strconv.Itoa(params.SubmodulesDepth))
+		}
+	}
+	if len(params.SparsePaths) > 0 {
+		args = append(args, "--sparse", strings.Join(params.SparsePaths, ","))
+	}
+	if params.LFS {
+		args = append(args, "--lfs")
+		if len(params.LFSInclude) > 0 {
+			args = append(args, "--lfs-include", strings.Join(params.LFSInclude, ","))
+		}
+		if len(params.LFSExclude) > 0 {
+			args = append(args, "--lfs-exclude", strings.Join(params.LFSExclude, ","))
+		}
+	}
+
+	// public keys used to verify signatures are mounted from the `kind: ConfigMap`
+	if params.VerifyKeysConfigMap != "" {
+		extraMounts = append(extraMounts, injectKeysVolume(pod, params))
+		args = append(args, "--verify-keys-path", KeysMountPath)
+	}
+
+	args = append(args, "--clean-remotes")
+
+	if params.CleanUpWorkspace {
 		args = append(args, "--clean-workspace")
 	}
 
+	if params.Chown {
+		args = append(args, "--chown", owner+":"+group, "--chmod", params.ChmodPolicy)
+		if params.ChownGitDir {
+			args = append(args, "--chown-git-dir")
+		}
+	}
+
+	// the controller copies the summary of a finished checkout into Pod annotations
+	if subcommand == "checkout" {
+		args = append(args, "--termination-message-path", corev1.TerminationMessagePathDefault)
+	}
+
 	container := corev1.Container{
-		Name:       InitContainerName,
-		Image:      image,
+		Name:       ContainerName(params),
+		Image:      params.Image,
 		Command:    []string{"/usr/bin/git-clone-controller"},
 		Args:       args,
 		WorkingDir: "/",
+		Env:        append(createCredentialsEnv(params), workspaceEnv...),
 		// EnvFrom:    nil,
-		VolumeMounts: mergeVolumeMounts(pod.Spec.Containers, path),
+		VolumeMounts: append(workspaceMounts, extraMounts...),
 		// VolumeDevices:            nil,
 		ImagePullPolicy: "Always",
 	}
 
+	// chown mode: root writes the files, then hands them over to the owner. Only capabilities needed for that are kept
+	if params.Chown {
+		logrus.Infof("Running as root with CAP_CHOWN, files handed over to UID=%v, GID=%v", owner, group)
+		container.SecurityContext = chownSecurityContext(params)
+		return container, nil
+	}
+
 	// run container as specified user to operate on volume with given permissions
 	if owner != "" && group != "" {
 		logrus.Infof("Using UID=%v, GID=%v", owner, group)
@@ -81,42 +228,157 @@ func injectInitContainer(pod *corev1.Pod, image string, path string, rev string,
 		}
 	}
 
-	pod.Spec.InitContainers = append(pod.Spec.InitContainers, container)
+	return container, nil
 }
 
-// mergeVolumeMounts merges volume mounts of multiple containers
-func mergeVolumeMounts(containers []corev1.Container, targetPath string) []corev1.VolumeMount {
-	var merged []corev1.VolumeMount
-	var appendedPaths []string
+// chownSecurityContext runs the checkout as root, without any capability other than:
+//   - CHOWN: take files of a previous checkout back before the update, then hand them over to the owner
+//   - FOWNER: only with a chmod policy, to change modes of files already handed over to the owner
+func chownSecurityContext(params appCtx.Parameters) *corev1.SecurityContext {
+	root := int64(0)
+	asNonRoot := false
+	allowPrivilegeEscalation := false
+	roFilesystem := false
+	capabilities := []corev1.Capability{"CHOWN"}
+	if params.ChmodPolicy != appCtx.ChmodKeep {
+		capabilities = append(capabilities, "FOWNER")
+	}
+	return &corev1.SecurityContext{
+		RunAsUser:                &root,
+		RunAsGroup:               &root,
+		RunAsNonRoot:             &asNonRoot,
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		ReadOnlyRootFilesystem:   &roFilesystem,
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+			Add:  capabilities,
+		},
+	}
+}
 
-	for _, container := range containers {
-		for _, volume := range container.VolumeMounts {
-			for _, existingPath := range appendedPaths {
-				// already collected
-				if existingPath == volume.MountPath {
-					continue
-				}
-			}
+// createCredentialsEnv references GIT credentials from the `kind: Secret` as environment variables read by `checkout` command,
+// so the token is never placed in the Pod specification, where everybody allowed to read the Pod would see it
+func createCredentialsEnv(params appCtx.Parameters) []corev1.EnvVar {
+	var env []corev1.EnvVar
 
-			// do not collect non-related mount points at all
-			if !strings.HasPrefix(targetPath, volume.MountPath) {
-				continue
-			}
+	if params.Secret.IsDefined() {
+		if params.Secret.TokenKey != "" {
+			env = append(env, corev1.EnvVar{
+				Name:      "GIT_TOKEN",
+				ValueFrom: secretKeyRef(params.Secret.Name, params.Secret.TokenKey),
+			})
+		}
+		if params.Secret.UsernameKey != "" {
+			env = append(env, corev1.EnvVar{
+				Name:      "GIT_USER",
+				ValueFrom: secretKeyRef(params.Secret.Name, params.Secret.UsernameKey),
+			})
+		}
+		if params.Secret.SSHKeyKey != "" && params.Secret.SSHKeyPassphraseKey != "" {
+			env = append(env, corev1.EnvVar{
+				Name:      "GIT_SSH_KEY_PASSPHRASE",
+				ValueFrom: secretKeyRef(params.Secret.Name, params.Secret.SSHKeyPassphraseKey),
+			})
+		}
+	}
+	return env
+}
 
-			logrus.Infof("Collecting VolumeMount: %v", volume.String())
-			appendedPaths = append(appendedPaths, volume.MountPath)
-			merged = append(merged, volume)
+// injectSSHVolume adds a volume with SSH private key and known_hosts taken from `kind: Secret`, returns mounts for the initContainer
+func injectSSHVolume(pod *corev1.Pod, params appCtx.Parameters) []corev1.VolumeMount {
+	secret := params.Secret
+	volumeName := withSpecSuffix(SSHVolumeName, params.Name)
+	items := []corev1.KeyToPath{{Key: secret.SSHKeyKey, Path: "identity"}}
+	if secret.KnownHostsKey != "" {
+		items = append(items, corev1.KeyToPath{Key: secret.KnownHostsKey, Path: "known_hosts"})
+	}
+
+	// readable for the non-root user the initContainer is running as, even without `fsGroup`
+	mode := int32(0444)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: volumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName:  secret.Name,
+				Items:       items,
+				DefaultMode: &mode,
+			},
+		},
+	})
+
+	return []corev1.VolumeMount{{Name: volumeName, MountPath: SSHMountPath, ReadOnly: true}}
+}
+
+// provisionVolume adds an `emptyDir` volume mounted at the target path in selected (by default: all) application containers,
+// returns mount for the initContainer
+func provisionVolume(pod *corev1.Pod, params appCtx.Parameters) ([]corev1.VolumeMount, error) {
+	volumeName := withSpecSuffix(WorkspaceVolume, params.Name)
+	mount := corev1.VolumeMount{Name: volumeName, MountPath: params.TargetPath}
+
+	for _, name := range params.ProvisionVolumeContainers {
+		if !hasContainer(pod.Spec.Containers, name) {
+			return nil, RejectionError{Reason: fmt.Sprintf("container '%s' selected in annotation '%s' does not exist", name, appCtx.AnnotationProvisionVolumeContainers)}
 		}
 	}
+	for i, container := range pod.Spec.Containers {
+		if len(params.ProvisionVolumeContainers) > 0 && !contains(params.ProvisionVolumeContainers, container.Name) {
+			continue
+		}
+		pod.Spec.Containers[i].VolumeMounts = append(pod.Spec.Containers[i].VolumeMounts, mount)
+	}
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name:         volumeName,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+
+	logrus.Infof("Provisioned emptyDir volume '%s' at '%s'", volumeName, params.TargetPath)
+	return []corev1.VolumeMount{mount}, nil
+}
 
-	return merged
+// injectKeysVolume adds a volume with public keys taken from `kind: ConfigMap`, returns mount for the initContainer
+func injectKeysVolume(pod *corev1.Pod, params appCtx.Parameters) corev1.VolumeMount {
+	volumeName := withSpecSuffix(KeysVolumeName, params.Name)
+	mode := int32(0444)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: volumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: params.VerifyKeysConfigMap},
+				DefaultMode:          &mode,
+			},
+		},
+	})
+	return corev1.VolumeMount{Name: volumeName, MountPath: KeysMountPath, ReadOnly: true}
 }
 
-func hasGitInitContainer(pod *corev1.Pod) bool {
-	for _, container := range pod.Spec.InitContainers {
-		if container.Name == InitContainerName {
+func secretKeyRef(name string, key string) *corev1.EnvVarSource {
+	return &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name},
+			Key:                  key,
+		},
+	}
+}
+
+func hasContainer(containers []corev1.Container, name string) bool {
+	for _, container := range containers {
+		if container.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
 			return true
 		}
 	}
 	return false
 }
+
+func hasGitInitContainer(pod *corev1.Pod, name string) bool {
+	// `sync` may be injected as a regular container
+	return hasContainer(pod.Spec.InitContainers, name) || hasContainer(pod.Spec.Containers, name)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/yaml"
+	"strings"
 	"testing"
 )
 
@@ -49,7 +50,7 @@ func TestMutatePodByInjectingInitContainer(t *testing.T) {
 		GitRevision: "main",
 		FilesOwner:  "1000",
 		FilesGroup:  "1001",
-		TargetPath:  "/workspace/git",
+		TargetPath:  "/workspace/source/git",
 		Image:       "ghcr.io/peter/kropotkin",
 	}
 
@@ -63,7 +64,8 @@ func TestMutatePodByInjectingInitContainer(t *testing.T) {
 	assert.Equal(t, "ghcr.io/peter/kropotkin", m.Spec.InitContainers[0].Image)
 
 	// this may fail time-to-time if commandline will be changed
-	assert.Equal(t, []string{"checkout", "https://github.com/riotkit-org/backup-repository", "--path", "/workspace/git", "--rev", "main", "--token", "", "--username", "", "--clean-remotes"}, m.Spec.InitContainers[0].Args)
+	assert.Equal(t, []string{"checkout", "https://github.com/riotkit-org/backup-repository", "--path", "/workspace/source/git", "--rev", "main", "--clean-remotes", "--termination-message-path", "/dev/termination-log"}, m.Spec.InitContainers[0].Args)
+	assert.Empty(t, m.Spec.InitContainers[0].Env)
 
 	// security context
 	runAsRoot := true
@@ -87,7 +89,7 @@ func TestMutatePodByInjectingInitContainer_WithoutSecurityContext(t *testing.T)
 		GitRevision: "main",
 		FilesOwner:  "",
 		FilesGroup:  "",
-		TargetPath:  "/workspace/git",
+		TargetPath:  "/workspace/source/git",
 		Image:       "ghcr.io/peter/kropotkin",
 	}
 
@@ -99,3 +101,317 @@ func TestMutatePodByInjectingInitContainer_WithoutSecurityContext(t *testing.T)
 	// security context
 	assert.Nil(t, m.Spec.InitContainers[0].SecurityContext)
 }
+
+func TestMutatePodByInjectingInitContainer_TokenIsReferencedFromSecret(t *testing.T) {
+	examplePod := &corev1.Pod{}
+	if err := yaml.Unmarshal([]byte(exampleSpec), &examplePod); err != nil {
+		logrus.Fatal(err)
+	}
+
+	params := context.Parameters{
+		GitUrl:      "https://github.com/riotkit-org/backup-repository",
+		GitRevision: "main",
+		Secret:      context.SecretReference{Name: "git-secrets", TokenKey: "token", UsernameKey: "user"},
+		TargetPath:  "/workspace/source/git",
+		Image:       "ghcr.io/peter/kropotkin",
+	}
+
+	m, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+
+	assert.Nil(t, err)
+	assert.NotContains(t, m.Spec.InitContainers[0].Args, "--token")
+	assert.NotContains(t, m.Spec.InitContainers[0].Args, "--username")
+	assert.Equal(t, []corev1.EnvVar{
+		{Name: "GIT_TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "git-secrets"}, Key: "token",
+		}}},
+		{Name: "GIT_USER", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "git-secrets"}, Key: "user",
+		}}},
+	}, m.Spec.InitContainers[0].Env)
+}
+
+func TestMutatePodByInjectingInitContainer_SSHKeyIsMountedFromSecret(t *testing.T) {
+	examplePod := &corev1.Pod{}
+	if err := yaml.Unmarshal([]byte(exampleSpec), &examplePod); err != nil {
+		logrus.Fatal(err)
+	}
+
+	params := context.Parameters{
+		GitUrl:      "git@github.com:riotkit-org/backup-repository.git",
+		GitRevision: "main",
+		Secret:      context.SecretReference{Name: "git-secrets", SSHKeyKey: "id_ed25519", KnownHostsKey: "known_hosts"},
+		TargetPath:  "/workspace/source",
+		Image:       "ghcr.io/peter/kropotkin",
+	}
+
+	m, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"checkout", "git@github.com:riotkit-org/backup-repository.git", "--path", "/workspace/source", "--rev", "main",
+		"--ssh-key-path", "/etc/git-clone-controller/ssh/identity", "--known-hosts-path", "/etc/git-clone-controller/ssh/known_hosts",
+		"--clean-remotes", "--termination-message-path", "/dev/termination-log"}, m.Spec.InitContainers[0].Args)
+	assert.Empty(t, m.Spec.InitContainers[0].Env, "No token is expected for SSH")
+
+	// volume from secret
+	assert.Len(t, m.Spec.Volumes, 2)
+	assert.Equal(t, "git-secrets", m.Spec.Volumes[1].Secret.SecretName)
+	assert.Equal(t, []corev1.KeyToPath{{Key: "id_ed25519", Path: "identity"}, {Key: "known_hosts", Path: "known_hosts"}}, m.Spec.Volumes[1].Secret.Items)
+
+	// mounted only in initContainer, next to the workspace
+	assert.Equal(t, []corev1.VolumeMount{
+		{Name: "workspace", MountPath: "/workspace/source"},
+		{Name: "git-clone-controller-ssh", MountPath: "/etc/git-clone-controller/ssh", ReadOnly: true},
+	}, m.Spec.InitContainers[0].VolumeMounts)
+	assert.Len(t, m.Spec.Containers[0].VolumeMounts, 1)
+
+	// passphrase of an encrypted key is referenced from the same secret
+	params.Secret.SSHKeyPassphraseKey = "passphrase"
+	encrypted, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.EnvVar{{Name: "GIT_SSH_KEY_PASSPHRASE", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "git-secrets"}, Key: "passphrase",
+	}}}}, encrypted.Spec.InitContainers[0].Env)
+}
+
+func TestMutatePodByInjectingInitContainer_MultipleRepositories(t *testing.T) {
+	examplePod := &corev1.Pod{}
+	if err := yaml.Unmarshal([]byte(exampleSpec), &examplePod); err != nil {
+		logrus.Fatal(err)
+	}
+
+	theme := context.Parameters{
+		Name:        "theme",
+		GitUrl:      "git@github.com:riotkit-org/wordpress-theme.git",
+		GitRevision: "main",
+		Secret:      context.SecretReference{Name: "theme-secrets", SSHKeyKey: "id_ed25519"},
+		TargetPath:  "/workspace/source/theme",
+		Image:       "ghcr.io/peter/kropotkin",
+	}
+	plugins := context.Parameters{
+		Name:        "plugins",
+		GitUrl:      "https://github.com/riotkit-org/wordpress-plugins",
+		GitRevision: "v1.0",
+		Secret:      context.SecretReference{Name: "plugins-secrets", TokenKey: "token"},
+		TargetPath:  "/workspace/source/plugins",
+		Image:       "ghcr.io/peter/kropotkin",
+	}
+
+	m, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, theme, plugins)
+
+	assert.Nil(t, err)
+	assert.Len(t, m.Spec.InitContainers, 2)
+	assert.Equal(t, "git-checkout-theme", m.Spec.InitContainers[0].Name)
+	assert.Equal(t, "git-checkout-plugins", m.Spec.InitContainers[1].Name)
+	assert.Equal(t, "plugins-secrets", m.Spec.InitContainers[1].Env[0].ValueFrom.SecretKeyRef.Name)
+	assert.Equal(t, "git-clone-controller-ssh-theme", m.Spec.Volumes[1].Name)
+	assert.Equal(t, "git-clone-controller-ssh-theme", m.Spec.InitContainers[0].VolumeMounts[1].Name)
+	assert.Len(t, m.Spec.InitContainers[1].VolumeMounts, 1)
+
+	// mutating again does not duplicate initContainers
+	again, _ := mutation.MutatePodByInjectingInitContainer(m, &logrus.Logger{}, theme, plugins)
+	assert.Len(t, again.Spec.InitContainers, 2)
+}
+
+func TestMutatePodByInjectingInitContainer_ShallowClone(t *testing.T) {
+	examplePod := &corev1.Pod{}
+	if err := yaml.Unmarshal([]byte(exampleSpec), &examplePod); err != nil {
+		logrus.Fatal(err)
+	}
+
+	params := context.Parameters{
+		GitUrl:       "https://github.com/riotkit-org/backup-repository",
+		GitRevision:  "main",
+		TargetPath:   "/workspace/source",
+		Image:        "ghcr.io/peter/kropotkin",
+		Depth:        1,
+		SingleBranch: true,
+		NoTags:       true,
+		SparsePaths:  []string{"themes/iwa", "plugins"},
+		Submodules:   true,
+		LFS:          true,
+		LFSExclude:   []string{"*.mp4"},
+	}
+
+	m, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"checkout", "https://github.com/riotkit-org/backup-repository",
+		"--path", "/workspace/source",
+		"--rev", "main",
+		"--depth", "1",
+		"--single-branch",
+		"--no-tags",
+		"--recurse-submodules",
+		"--sparse", "themes/iwa,plugins",
+		"--lfs",
+		"--lfs-exclude", "*.mp4",
+		"--clean-remotes",
+		"--termination-message-path", "/dev/termination-log",
+	}, m.Spec.InitContainers[0].Args)
+}
+
+func TestMutatePodByInjectingInitContainer_VerifyKeysAreMountedFromConfigMap(t *testing.T) {
+	examplePod := &corev1.Pod{}
+	if err := yaml.Unmarshal([]byte(exampleSpec), &examplePod); err != nil {
+		logrus.Fatal(err)
+	}
+
+	params := context.Parameters{
+		GitUrl:              "https://github.com/riotkit-org/backup-repository",
+		GitRevision:         "v1.0.0",
+		TargetPath:          "/workspace/source",
+		Image:               "ghcr.io/peter/kropotkin",
+		VerifyKeysConfigMap: "trusted-maintainers",
+	}
+
+	m, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+
+	assert.Nil(t, err)
+	assert.Contains(t, m.Spec.InitContainers[0].Args, "--verify-keys-path")
+	assert.Equal(t, "trusted-maintainers", m.Spec.Volumes[1].ConfigMap.Name)
+	assert.Equal(t, []corev1.VolumeMount{
+		{Name: "workspace", MountPath: "/workspace/source"},
+		{Name: "git-clone-controller-keys", MountPath: "/etc/git-clone-controller/keys", ReadOnly: true},
+	}, m.Spec.InitContainers[0].VolumeMounts)
+}
+
+func TestMutatePodByInjectingInitContainer_RejectsPathOutsideOfVolumes(t *testing.T) {
+	examplePod := &corev1.Pod{}
+	if err := yaml.Unmarshal([]byte(exampleSpec), &examplePod); err != nil {
+		logrus.Fatal(err)
+	}
+
+	params := context.Parameters{
+		GitUrl:      "https://github.com/riotkit-org/backup-repository",
+		GitRevision: "main",
+		TargetPath:  "/var/www/html",
+		Image:       "ghcr.io/peter/kropotkin",
+	}
+
+	_, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+
+	assert.ErrorAs(t, err, &mutation.RejectionError{})
+	assert.Contains(t, err.Error(), "no container mounts a volume containing path '/var/www/html'")
+}
+
+func TestMutatePodByInjectingInitContainer_NamesFitIntoDNSLabel(t *testing.T) {
+	examplePod := &corev1.Pod{}
+	if err := yaml.Unmarshal([]byte(exampleSpec), &examplePod); err != nil {
+		logrus.Fatal(err)
+	}
+
+	params := context.Parameters{
+		Name:                strings.Repeat("a", context.MaxSpecNameLength),
+		GitUrl:              "git@github.com:riotkit-org/backup-repository.git",
+		GitRevision:         "main",
+		TargetPath:          "/var/www/html",
+		Image:               "ghcr.io/peter/kropotkin",
+		Secret:              context.SecretReference{Name: "git-secrets", SSHKeyKey: "id_ed25519", KnownHostsKey: "known_hosts"},
+		VerifyKeysConfigMap: "trusted-maintainers",
+		ProvisionVolume:     true,
+	}
+
+	m, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+
+	assert.Nil(t, err)
+	assert.Len(t, m.Spec.Volumes, 4)
+	for _, volume := range m.Spec.Volumes {
+		assert.LessOrEqual(t, len(volume.Name), 63, volume.Name)
+	}
+	for _, container := range m.Spec.InitContainers {
+		assert.LessOrEqual(t, len(container.Name), 63, container.Name)
+	}
+}
+
+func TestMutatePodByInjectingInitContainer_ProvisionsVolume(t *testing.T) {
+	examplePod := &corev1.Pod{}
+	if err := yaml.Unmarshal([]byte(exampleSpec), &examplePod); err != nil {
+		logrus.Fatal(err)
+	}
+	examplePod.Spec.Containers = append(examplePod.Spec.Containers, corev1.Container{Name: "metrics", Image: "busybox:latest"})
+
+	params := context.Parameters{
+		GitUrl:                    "https://github.com/riotkit-org/backup-repository",
+		GitRevision:               "main",
+		TargetPath:                "/var/www/html",
+		Image:                     "ghcr.io/peter/kropotkin",
+		ProvisionVolume:           true,
+		ProvisionVolumeContainers: []string{"test"},
+	}
+
+	m, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+
+	assert.Nil(t, err)
+	mount := corev1.VolumeMount{Name: "git-clone-controller-workspace", MountPath: "/var/www/html"}
+	assert.Equal(t, "git-clone-controller-workspace", m.Spec.Volumes[1].Name)
+	assert.NotNil(t, m.Spec.Volumes[1].EmptyDir)
+	assert.Equal(t, []corev1.VolumeMount{mount}, m.Spec.InitContainers[0].VolumeMounts)
+	assert.Contains(t, m.Spec.Containers[0].VolumeMounts, mount)
+	assert.Empty(t, m.Spec.Containers[1].VolumeMounts, "Expected that only selected containers will have the volume mounted")
+
+	params.ProvisionVolumeContainers = []string{"nginx"}
+	_, unknownErr := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+	assert.ErrorAs(t, unknownErr, &mutation.RejectionError{})
+}
+
+func TestMutatePodByInjectingInitContainer_ChownRunsAsRootWithCapChown(t *testing.T) {
+	examplePod := &corev1.Pod{}
+	if err := yaml.Unmarshal([]byte(exampleSpec), &examplePod); err != nil {
+		logrus.Fatal(err)
+	}
+
+	params := context.Parameters{
+		GitUrl:      "https://github.com/riotkit-org/backup-repository",
+		GitRevision: "main",
+		TargetPath:  "/workspace/source",
+		Image:       "ghcr.io/peter/kropotkin",
+		FilesOwner:  "1000",
+		FilesGroup:  "1001",
+		Chown:       true,
+		ChownGitDir: true,
+		ChmodPolicy: context.ChmodGroupWritable,
+	}
+
+	m, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+
+	assert.Nil(t, err)
+	container := m.Spec.InitContainers[0]
+	assert.Contains(t, container.Args, "--chown-git-dir")
+	assert.Subset(t, container.Args, []string{"--chown", "1000:1001", "--chmod", "group-writable"})
+
+	securityContext := container.SecurityContext
+	assert.Equal(t, int64(0), *securityContext.RunAsUser)
+	assert.False(t, *securityContext.RunAsNonRoot)
+	assert.False(t, *securityContext.AllowPrivilegeEscalation, "Root must not be able to gain more privileges")
+	assert.Nil(t, securityContext.Privileged)
+	assert.Equal(t, []corev1.Capability{"ALL"}, securityContext.Capabilities.Drop)
+	assert.Equal(t, []corev1.Capability{"CHOWN", "FOWNER"}, securityContext.Capabilities.Add, "Expected FOWNER to change modes of files handed over to the owner")
+
+	params.ChmodPolicy = context.ChmodKeep
+	keep, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.Capability{"CHOWN"}, keep.Spec.InitContainers[0].SecurityContext.Capabilities.Add, "Expected only CHOWN, when modes are kept")
+}
+
+func TestMutatePodByInjectingInitContainer_TokenIsNeverPlacedInPodSpecification(t *testing.T) {
+	examplePod := &corev1.Pod{}
+	if err := yaml.Unmarshal([]byte(exampleSpec), &examplePod); err != nil {
+		logrus.Fatal(err)
+	}
+
+	params := context.Parameters{
+		GitUrl:      "https://github.com/riotkit-org/backup-repository",
+		GitToken:    "solidarity",
+		GitRevision: "main",
+		TargetPath:  "/workspace/source/git",
+		Image:       "ghcr.io/peter/kropotkin",
+	}
+
+	m, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+
+	assert.Nil(t, err)
+	assert.Empty(t, m.Spec.InitContainers[0].Env, "Expected that operator-wide token is not handed over to the Pod")
+	assert.NotContains(t, m.Spec.InitContainers[0].Args, "solidarity")
+}
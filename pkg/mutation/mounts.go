@@ -0,0 +1,69 @@
+package mutation
+
+import (
+	"fmt"
+	appCtx "github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"regexp"
+)
+
+// subPathExprVariable matches `$(VAR_NAME)` references in `subPathExpr`
+var subPathExprVariable = regexp.MustCompile(`\$\(([A-Za-z_][A-Za-z0-9_]*)\)`)
+
+// planVolumeMounts picks the deepest volume mount of application containers that contains the target path, so the clone lands
+// in the same place the application sees. `subPath` and `subPathExpr` are kept - environment variables referenced by `subPathExpr`
+// are returned to be copied into the git container. No mounts are returned, when the target path is not placed on any volume
+func planVolumeMounts(containers []corev1.Container, targetPath string) ([]corev1.VolumeMount, []corev1.EnvVar, error) {
+	deepest, mounts := appCtx.DeepestMounts(containers, targetPath)
+	if len(mounts) == 0 {
+		return nil, nil, nil
+	}
+	candidates := make([]corev1.VolumeMount, 0, len(mounts))
+	for _, mount := range mounts {
+		candidates = append(candidates, mount.Mount)
+	}
+
+	// the deepest mount shadows all others, the application containers see only it
+	for i, volume := range candidates {
+		if volume.ReadOnly {
+			continue
+		}
+		if differs := findDifferentMount(candidates, volume); differs != nil {
+			logrus.Warnf("Containers mount different volumes at '%s' (%v and %v), using the first one", deepest, volume.String(), differs.String())
+		}
+		logrus.Infof("Collecting VolumeMount: %v", volume.String())
+		mount := corev1.VolumeMount{
+			Name:             volume.Name,
+			MountPath:        volume.MountPath,
+			SubPath:          volume.SubPath,
+			SubPathExpr:      volume.SubPathExpr,
+			MountPropagation: volume.MountPropagation,
+		}
+		return []corev1.VolumeMount{mount}, subPathExprEnv(*mounts[i].Container, volume.SubPathExpr), nil
+	}
+	return nil, nil, RejectionError{Reason: fmt.Sprintf("path '%s' is placed on a read-only volume mount '%s', the repository cannot be cloned there", targetPath, deepest)}
+}
+
+// findDifferentMount returns a mount that points to other volume or other subPath than the given one
+func findDifferentMount(mounts []corev1.VolumeMount, mount corev1.VolumeMount) *corev1.VolumeMount {
+	for _, other := range mounts {
+		if other.Name != mount.Name || other.SubPath != mount.SubPath || other.SubPathExpr != mount.SubPathExpr {
+			return &other
+		}
+	}
+	return nil
+}
+
+// subPathExprEnv returns container's environment variables referenced in `subPathExpr`
+func subPathExprEnv(container corev1.Container, subPathExpr string) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	for _, match := range subPathExprVariable.FindAllStringSubmatch(subPathExpr, -1) {
+		for _, variable := range container.Env {
+			if variable.Name == match[1] {
+				env = append(env, variable)
+			}
+		}
+	}
+	return env
+}
@@ -0,0 +1,87 @@
+package mutation_test
+
+import (
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/riotkit-org/git-clone-controller/pkg/mutation"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"testing"
+)
+
+func createPodWithMounts(mounts ...corev1.VolumeMount) *corev1.Pod {
+	return &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{
+		{
+			Name:         "app",
+			Image:        "busybox:latest",
+			VolumeMounts: mounts,
+			Env:          []corev1.EnvVar{{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}}},
+		},
+	}}}
+}
+
+func mutateWithTargetPath(pod *corev1.Pod, targetPath string) (*corev1.Pod, error) {
+	return mutation.MutatePodByInjectingInitContainer(pod, &logrus.Logger{}, context.Parameters{
+		GitUrl:      "https://github.com/riotkit-org/backup-repository",
+		GitRevision: "main",
+		TargetPath:  targetPath,
+		Image:       "ghcr.io/peter/kropotkin",
+	})
+}
+
+func TestPlanVolumeMounts_PicksDeepestMount(t *testing.T) {
+	pod := createPodWithMounts(
+		corev1.VolumeMount{Name: "root", MountPath: "/var"},
+		corev1.VolumeMount{Name: "html", MountPath: "/var/www/"},
+		corev1.VolumeMount{Name: "sibling", MountPath: "/var/www/html2"},
+	)
+
+	m, err := mutateWithTargetPath(pod, "/var/www/html")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.VolumeMount{{Name: "html", MountPath: "/var/www/"}}, m.Spec.InitContainers[0].VolumeMounts)
+}
+
+func TestPlanVolumeMounts_DoesNotMatchSiblingPrefix(t *testing.T) {
+	pod := createPodWithMounts(corev1.VolumeMount{Name: "html", MountPath: "/var/www"})
+
+	_, err := mutateWithTargetPath(pod, "/var/www2/theme")
+
+	assert.ErrorAs(t, err, &mutation.RejectionError{})
+}
+
+func TestPlanVolumeMounts_KeepsSubPath(t *testing.T) {
+	pod := createPodWithMounts(
+		corev1.VolumeMount{Name: "data", MountPath: "/var/www/html", SubPath: "html"},
+		corev1.VolumeMount{Name: "data", MountPath: "/var/cache", SubPathExpr: "cache/$(POD_NAME)"},
+	)
+
+	html, err := mutateWithTargetPath(pod.DeepCopy(), "/var/www/html")
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.VolumeMount{{Name: "data", MountPath: "/var/www/html", SubPath: "html"}}, html.Spec.InitContainers[0].VolumeMounts)
+
+	cache, err := mutateWithTargetPath(pod.DeepCopy(), "/var/cache/repository")
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.VolumeMount{{Name: "data", MountPath: "/var/cache", SubPathExpr: "cache/$(POD_NAME)"}}, cache.Spec.InitContainers[0].VolumeMounts)
+	assert.Contains(t, cache.Spec.InitContainers[0].Env, pod.Spec.Containers[0].Env[0], "Expected that variables used in subPathExpr are copied")
+}
+
+func TestPlanVolumeMounts_DeniesReadOnlyMount(t *testing.T) {
+	pod := createPodWithMounts(
+		corev1.VolumeMount{Name: "workspace", MountPath: "/workspace"},
+		corev1.VolumeMount{Name: "config", MountPath: "/workspace/config", ReadOnly: true},
+	)
+
+	_, err := mutateWithTargetPath(pod.DeepCopy(), "/workspace/config/repository")
+	assert.ErrorAs(t, err, &mutation.RejectionError{})
+	assert.Contains(t, err.Error(), "is placed on a read-only volume mount '/workspace/config'")
+
+	// other container mounts the same path as writable
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
+		Name:         "writer",
+		VolumeMounts: []corev1.VolumeMount{{Name: "config", MountPath: "/workspace/config"}},
+	})
+	m, err := mutateWithTargetPath(pod, "/workspace/config/repository")
+	assert.Nil(t, err)
+	assert.Equal(t, []corev1.VolumeMount{{Name: "config", MountPath: "/workspace/config"}}, m.Spec.InitContainers[0].VolumeMounts)
+}
@@ -0,0 +1,37 @@
+package mutation
+
+import (
+	appCtx "github.com/riotkit-org/git-clone-controller/pkg/context"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// injectSyncContainer injects a long-running `sync` container that keeps the checkout updated while the Pod runs.
+// Native sidecar is an initContainer with `restartPolicy: Always` - it starts before the application and runs along with it.
+// Its startupProbe makes the application containers wait until the first checkout is published
+func injectSyncContainer(pod *corev1.Pod, params appCtx.Parameters) error {
+	container, err := createGitContainer(pod, params, "sync")
+	if err != nil {
+		return err
+	}
+	container.Args = append(container.Args, "--interval", params.SyncInterval)
+
+	if params.SidecarType == appCtx.SidecarTypeContainer {
+		pod.Spec.Containers = append(pod.Spec.Containers, container)
+		return nil
+	}
+
+	restartPolicy := corev1.ContainerRestartPolicyAlways
+	container.RestartPolicy = &restartPolicy
+	container.StartupProbe = &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"/usr/bin/git-clone-controller", "sync", "--probe", "--path", params.TargetPath},
+			},
+		},
+		PeriodSeconds: 2,
+		// up to 10 minutes for the initial clone
+		FailureThreshold: 300,
+	}
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, container)
+	return nil
+}
@@ -0,0 +1,70 @@
+package mutation_test
+
+import (
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/riotkit-org/git-clone-controller/pkg/mutation"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"testing"
+)
+
+func TestMutatePodByInjectingInitContainer_SyncAsNativeSidecar(t *testing.T) {
+	examplePod := &corev1.Pod{}
+	if err := yaml.Unmarshal([]byte(exampleSpec), &examplePod); err != nil {
+		logrus.Fatal(err)
+	}
+
+	params := context.Parameters{
+		GitUrl:       "https://github.com/riotkit-org/backup-repository",
+		GitRevision:  "main",
+		TargetPath:   "/workspace/source/theme",
+		Image:        "ghcr.io/peter/kropotkin",
+		Mode:         context.ModeSync,
+		SyncInterval: "30s",
+		SidecarType:  context.SidecarTypeNative,
+	}
+
+	m, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+
+	assert.Nil(t, err)
+	assert.Len(t, m.Spec.InitContainers, 1)
+	assert.Len(t, m.Spec.Containers, 1)
+
+	sidecar := m.Spec.InitContainers[0]
+	assert.Equal(t, "git-sync", sidecar.Name)
+	assert.Equal(t, corev1.ContainerRestartPolicyAlways, *sidecar.RestartPolicy)
+	assert.Equal(t, []string{"sync", "https://github.com/riotkit-org/backup-repository", "--path", "/workspace/source/theme", "--rev", "main", "--clean-remotes", "--interval", "30s"}, sidecar.Args)
+	assert.Equal(t, []string{"/usr/bin/git-clone-controller", "sync", "--probe", "--path", "/workspace/source/theme"}, sidecar.StartupProbe.Exec.Command)
+}
+
+func TestMutatePodByInjectingInitContainer_SyncAsRegularContainer(t *testing.T) {
+	examplePod := &corev1.Pod{}
+	if err := yaml.Unmarshal([]byte(exampleSpec), &examplePod); err != nil {
+		logrus.Fatal(err)
+	}
+
+	params := context.Parameters{
+		Name:         "theme",
+		GitUrl:       "https://github.com/riotkit-org/backup-repository",
+		GitRevision:  "main",
+		TargetPath:   "/workspace/source/theme",
+		Image:        "ghcr.io/peter/kropotkin",
+		Mode:         context.ModeSync,
+		SyncInterval: "1m",
+		SidecarType:  context.SidecarTypeContainer,
+	}
+
+	m, err := mutation.MutatePodByInjectingInitContainer(examplePod, &logrus.Logger{}, params)
+
+	assert.Nil(t, err)
+	assert.Len(t, m.Spec.InitContainers, 0)
+	assert.Len(t, m.Spec.Containers, 2)
+	assert.Equal(t, "git-sync-theme", m.Spec.Containers[1].Name)
+	assert.Nil(t, m.Spec.Containers[1].RestartPolicy)
+
+	// mutating again does not duplicate the sidecar
+	again, _ := mutation.MutatePodByInjectingInitContainer(m, &logrus.Logger{}, params)
+	assert.Len(t, again.Spec.Containers, 2)
+}
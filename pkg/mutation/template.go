@@ -0,0 +1,112 @@
+package mutation
+
+import (
+	appCtx "github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"sort"
+	"strings"
+)
+
+// MutatePodTemplate mutates a Pod template of a workload e.g. `kind: Deployment`.
+// Containers and volumes injected previously are removed first, so changed annotations are applied on workload update.
+// Names of injected containers and volumes are recorded in template annotations
+func MutatePodTemplate(pod *corev1.Pod, logger logrus.FieldLogger, params ...appCtx.Parameters) (*corev1.Pod, error) {
+	stripped := RemoveInjected(pod)
+	mutatedPod, err := MutatePodByInjectingInitContainer(stripped, logger, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	containers := newNames(containerNames(stripped), containerNames(mutatedPod))
+	volumes := newNames(volumeNames(stripped), volumeNames(mutatedPod))
+	if len(containers) > 0 || len(volumes) > 0 {
+		if mutatedPod.Annotations == nil {
+			mutatedPod.Annotations = map[string]string{}
+		}
+		mutatedPod.Annotations[appCtx.AnnotationInjectedContainers] = strings.Join(containers, ",")
+		mutatedPod.Annotations[appCtx.AnnotationInjectedVolumes] = strings.Join(volumes, ",")
+	}
+	return mutatedPod, nil
+}
+
+// RemoveInjected returns a copy of Pod (template) without containers, volumes and volume mounts recorded by MutatePodTemplate
+func RemoveInjected(pod *corev1.Pod) *corev1.Pod {
+	stripped := pod.DeepCopy()
+	containers := splitNames(stripped.Annotations[appCtx.AnnotationInjectedContainers])
+	volumes := splitNames(stripped.Annotations[appCtx.AnnotationInjectedVolumes])
+	delete(stripped.Annotations, appCtx.AnnotationInjectedContainers)
+	delete(stripped.Annotations, appCtx.AnnotationInjectedVolumes)
+
+	stripped.Spec.InitContainers = removeContainers(stripped.Spec.InitContainers, containers, volumes)
+	stripped.Spec.Containers = removeContainers(stripped.Spec.Containers, containers, volumes)
+
+	var keptVolumes []corev1.Volume
+	for _, volume := range stripped.Spec.Volumes {
+		if !contains(volumes, volume.Name) {
+			keptVolumes = append(keptVolumes, volume)
+		}
+	}
+	stripped.Spec.Volumes = keptVolumes
+	return stripped
+}
+
+// removeContainers removes containers by name, and mounts of given volumes from remaining containers
+func removeContainers(containers []corev1.Container, names []string, volumes []string) []corev1.Container {
+	var kept []corev1.Container
+	for _, container := range containers {
+		if contains(names, container.Name) {
+			continue
+		}
+		var mounts []corev1.VolumeMount
+		for _, mount := range container.VolumeMounts {
+			if !contains(volumes, mount.Name) {
+				mounts = append(mounts, mount)
+			}
+		}
+		container.VolumeMounts = mounts
+		kept = append(kept, container)
+	}
+	return kept
+}
+
+func containerNames(pod *corev1.Pod) []string {
+	var names []string
+	for _, container := range pod.Spec.InitContainers {
+		names = append(names, container.Name)
+	}
+	for _, container := range pod.Spec.Containers {
+		names = append(names, container.Name)
+	}
+	return names
+}
+
+func volumeNames(pod *corev1.Pod) []string {
+	var names []string
+	for _, volume := range pod.Spec.Volumes {
+		names = append(names, volume.Name)
+	}
+	return names
+}
+
+// newNames returns names present only in the `after` list
+func newNames(before []string, after []string) []string {
+	var added []string
+	for _, name := range after {
+		if !contains(before, name) {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	return added
+}
+
+func splitNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,47 @@
+package mutation_test
+
+import (
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/riotkit-org/git-clone-controller/pkg/mutation"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"testing"
+)
+
+func TestMutatePodTemplate_ReplacesPreviouslyInjectedContainers(t *testing.T) {
+	template := &corev1.Pod{}
+	if err := yaml.Unmarshal([]byte(exampleSpec), &template); err != nil {
+		logrus.Fatal(err)
+	}
+	params := context.Parameters{
+		GitUrl:              "https://github.com/riotkit-org/backup-repository",
+		GitRevision:         "v1.0.0",
+		TargetPath:          "/var/www/html",
+		Image:               "ghcr.io/peter/kropotkin",
+		ProvisionVolume:     true,
+		VerifyKeysConfigMap: "trusted-maintainers",
+	}
+
+	first, err := mutation.MutatePodTemplate(template, &logrus.Logger{}, params)
+	assert.Nil(t, err)
+	assert.Equal(t, "git-checkout", first.Annotations["git-clone-controller/injectedContainers"])
+	assert.Equal(t, "git-clone-controller-keys,git-clone-controller-workspace", first.Annotations["git-clone-controller/injectedVolumes"])
+
+	// workload was updated with other revision and without verification
+	params.GitRevision = "v2.0.0"
+	params.VerifyKeysConfigMap = ""
+	second, err := mutation.MutatePodTemplate(first, &logrus.Logger{}, params)
+	assert.Nil(t, err)
+	assert.Len(t, second.Spec.InitContainers, 1)
+	assert.Contains(t, second.Spec.InitContainers[0].Args, "v2.0.0")
+	assert.Len(t, second.Spec.Volumes, 2, "Expected: the original volume and a single provisioned volume")
+	assert.Len(t, second.Spec.Containers[0].VolumeMounts, 2, "Expected that the provisioned volume is mounted only once")
+	assert.Equal(t, "git-clone-controller-workspace", second.Annotations["git-clone-controller/injectedVolumes"])
+
+	stripped := mutation.RemoveInjected(second)
+	assert.Empty(t, stripped.Spec.InitContainers)
+	assert.Equal(t, template.Spec, stripped.Spec)
+	assert.NotContains(t, stripped.Annotations, "git-clone-controller/injectedContainers")
+}
@@ -0,0 +1,116 @@
+package report
+
+import (
+	goCtx "context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/riotkit-org/git-clone-controller/pkg/context"
+	"github.com/riotkit-org/git-clone-controller/pkg/mutation"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"strings"
+	"time"
+)
+
+// Controller watches labelled Pods and copies checkout summaries from initContainers termination messages into Pod annotations
+type Controller struct {
+	client  kubernetes.Interface
+	factory informers.SharedInformerFactory
+}
+
+func NewController(client kubernetes.Interface, resync time.Duration) *Controller {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, resync, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.LabelSelector = context.LabelIsEnabled + "=true"
+	}))
+	c := &Controller{client: client, factory: factory}
+
+	_, _ = factory.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.handle(obj)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			c.handle(obj)
+		},
+	})
+	return c
+}
+
+// Start begins watching Pods in background
+func (c *Controller) Start(stopCh <-chan struct{}) {
+	c.factory.Start(stopCh)
+}
+
+// handle annotates the Pod, when any of its initContainers finished a checkout
+func (c *Controller) handle(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	annotations := CreateAnnotations(pod)
+	if len(annotations) == 0 {
+		return
+	}
+	if err := c.annotate(pod, annotations); err != nil {
+		logrus.Warnf("Cannot report checkout on Pod '%s/%s': %v", pod.Namespace, pod.Name, err)
+		return
+	}
+	logrus.Infof("Reported checkout on Pod '%s/%s': %v", pod.Namespace, pod.Name, annotations)
+}
+
+// annotate patches only the Pod annotations
+func (c *Controller) annotate(pod *corev1.Pod, annotations map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := goCtx.WithTimeout(goCtx.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := c.client.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return errors.Wrap(err, "Cannot patch Pod annotations")
+	}
+	return nil
+}
+
+// CreateAnnotations returns annotations describing finished checkouts, which are not yet present on the Pod
+func CreateAnnotations(pod *corev1.Pod) map[string]string {
+	annotations := map[string]string{}
+	for _, status := range pod.Status.InitContainerStatuses {
+		spec, isCheckout := specFromContainerName(status.Name)
+		if !isCheckout || status.State.Terminated == nil || status.State.Terminated.ExitCode != 0 {
+			continue
+		}
+		summary, err := ParseSummary(status.State.Terminated.Message)
+		if err != nil {
+			logrus.Debugf("No checkout summary in container '%s' of Pod '%s/%s': %v", status.Name, pod.Namespace, pod.Name, err)
+			continue
+		}
+		content, _ := json.Marshal(summary)
+
+		names := context.ForSpec(pod.Annotations, spec)
+		for name, value := range map[string]string{
+			names.Name(context.AnnotationCheckedOutCommit): summary.Commit,
+			names.Name(context.AnnotationCheckoutSummary):  string(content),
+		} {
+			if pod.Annotations[name] != value {
+				annotations[name] = value
+			}
+		}
+	}
+	return annotations
+}
+
+// specFromContainerName returns name of the checkout specification e.g. "theme" for "git-checkout-theme"
+func specFromContainerName(name string) (string, bool) {
+	if name == mutation.InitContainerName {
+		return "", true
+	}
+	if strings.HasPrefix(name, mutation.InitContainerName+"-") {
+		return strings.TrimPrefix(name, mutation.InitContainerName+"-"), true
+	}
+	return "", false
+}
@@ -0,0 +1,70 @@
+package report_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/riotkit-org/git-clone-controller/pkg/report"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const exampleSummary = `{"url":"https://git.example.org/themes/iwa.git","ref":"refs/heads/main","commit":"a18e4351f42de0cd39627af7e2649dfa762877d0","commitTime":"1936-07-19T00:00:00Z","duration":"1.5s"}`
+
+func createPodWithFinishedCheckouts() *corev1.Pod {
+	terminated := func(name string, exitCode int32, message string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: name, State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Message: message}}}
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "wordpress",
+			Namespace: "anarchism",
+			Labels:    map[string]string{"riotkit.org/git-clone-controller": "true"},
+		},
+		Status: corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{
+			terminated("git-checkout", 0, exampleSummary),
+			terminated("git-checkout-plugins", 1, "Cannot clone"),
+			terminated("migrations", 0, exampleSummary),
+			{Name: "git-checkout-theme", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		}},
+	}
+}
+
+func TestCreateAnnotations(t *testing.T) {
+	pod := createPodWithFinishedCheckouts()
+
+	annotations := report.CreateAnnotations(pod)
+	assert.Equal(t, map[string]string{
+		"git-clone-controller/checkedOutCommit": "a18e4351f42de0cd39627af7e2649dfa762877d0",
+		"git-clone-controller/checkoutSummary":  exampleSummary,
+	}, annotations)
+
+	// already reported
+	pod.Annotations = annotations
+	assert.Empty(t, report.CreateAnnotations(pod))
+}
+
+func TestCreateAnnotations_NamedRepository(t *testing.T) {
+	pod := createPodWithFinishedCheckouts()
+	pod.Status.InitContainerStatuses[0].Name = "git-checkout-theme"
+
+	annotations := report.CreateAnnotations(pod)
+	assert.Equal(t, "a18e4351f42de0cd39627af7e2649dfa762877d0", annotations["git-clone-controller/theme.checkedOutCommit"])
+}
+
+func TestController_AnnotatesPod(t *testing.T) {
+	pod := createPodWithFinishedCheckouts()
+	client := fake.NewSimpleClientset(pod)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	report.NewController(client, 0).Start(stop)
+
+	assert.Eventually(t, func() bool {
+		annotated, _ := client.CoreV1().Pods("anarchism").Get(context.TODO(), "wordpress", metav1.GetOptions{})
+		return annotated.Annotations["git-clone-controller/checkedOutCommit"] == "a18e4351f42de0cd39627af7e2649dfa762877d0"
+	}, 5*time.Second, 10*time.Millisecond)
+}
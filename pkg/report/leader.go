@@ -0,0 +1,60 @@
+package report
+
+import (
+	goCtx "context"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"time"
+)
+
+// LeaderElection runs the Controller only on the replica holding a `kind: Lease`, so Pods are watched and patched by a single replica
+type LeaderElection struct {
+	client kubernetes.Interface
+	resync time.Duration
+	lock   resourcelock.Interface
+}
+
+func NewLeaderElection(client kubernetes.Interface, resync time.Duration, namespace string, leaseName string, identity string) *LeaderElection {
+	return &LeaderElection{
+		client: client,
+		resync: resync,
+		lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: leaseName},
+			Client:     client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+	}
+}
+
+// Start takes part in the election in background until stopCh is closed. A new Controller is started each time the lease is acquired
+func (l *LeaderElection) Start(stopCh <-chan struct{}) {
+	ctx, cancel := goCtx.WithCancel(goCtx.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go func() {
+		for ctx.Err() == nil {
+			leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+				Lock:            l.lock,
+				ReleaseOnCancel: true,
+				LeaseDuration:   15 * time.Second,
+				RenewDeadline:   10 * time.Second,
+				RetryPeriod:     2 * time.Second,
+				Callbacks: leaderelection.LeaderCallbacks{
+					// leading context is cancelled when the lease is lost, that stops the Pod informer
+					OnStartedLeading: func(leading goCtx.Context) {
+						logrus.Info("Acquired the lease, reporting checked out commits")
+						NewController(l.client, l.resync).Start(leading.Done())
+					},
+					OnStoppedLeading: func() {
+						logrus.Info("Not holding the lease anymore, stopped reporting checked out commits")
+					},
+				},
+			})
+		}
+	}()
+}
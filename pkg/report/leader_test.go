@@ -0,0 +1,43 @@
+package report_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/riotkit-org/git-clone-controller/pkg/report"
+	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLeaderElection_AnnotatesPodOnlyWhenHoldingLease(t *testing.T) {
+	holder := "git-clone-controller-0"
+	duration := int32(15)
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "git-clone-controller-report", Namespace: "riotkit"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &metav1.MicroTime{Time: time.Now()},
+			RenewTime:            &metav1.MicroTime{Time: time.Now()},
+		},
+	}
+	client := fake.NewSimpleClientset(createPodWithFinishedCheckouts(), lease)
+	isAnnotated := func() bool {
+		annotated, _ := client.CoreV1().Pods("anarchism").Get(context.TODO(), "wordpress", metav1.GetOptions{})
+		return annotated.Annotations["git-clone-controller/checkedOutCommit"] != ""
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	report.NewLeaderElection(client, 0, "riotkit", "git-clone-controller-report", "git-clone-controller-1").Start(stop)
+
+	// other replica holds the lease
+	assert.Never(t, isAnnotated, 500*time.Millisecond, 10*time.Millisecond)
+
+	// other replica is gone
+	assert.Nil(t, client.CoordinationV1().Leases("riotkit").Delete(context.TODO(), "git-clone-controller-report", metav1.DeleteOptions{}))
+	assert.Eventually(t, isAnnotated, 10*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,50 @@
+// Package report passes the result of a checkout from the initContainer back to the Pod's annotations
+package report
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Summary describes what was checked out, written by `checkout` to the container's termination message file
+type Summary struct {
+	Url        string    `json:"url"`
+	Ref        string    `json:"ref"`
+	Commit     string    `json:"commit"`
+	CommitTime time.Time `json:"commitTime"`
+	Duration   string    `json:"duration"`
+}
+
+// WriteSummary writes the summary as JSON to given file e.g. "/dev/termination-log"
+func WriteSummary(path string, summary Summary) error {
+	content, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// ParseSummary reads the summary from a termination message
+func ParseSummary(message string) (Summary, error) {
+	var summary Summary
+	if err := json.Unmarshal([]byte(message), &summary); err != nil {
+		return Summary{}, errors.Wrap(err, "Cannot parse checkout summary")
+	}
+	if summary.Commit == "" {
+		return Summary{}, errors.New("checkout summary does not contain a commit")
+	}
+	return summary, nil
+}
+
+// StripCredentials removes user and password (or token) from HTTP(S) url, GIT-SSH urls are returned as they are
+func StripCredentials(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.User == nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return rawUrl
+	}
+	u.User = nil
+	return u.String()
+}